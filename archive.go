@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	maxDeleteFiles   = 10
+	maxDeleteStrings = 2000
+	allowMassDelete  = false
+	restoreDeleted   = ""
+)
+
+// deletedArchive is everything needed to bring a deleted file back.
+type deletedArchive struct {
+	DeletedAt    time.Time              `json:"deletedAt"`
+	File         ParatranzFile          `json:"file"`
+	Translations []ParatranzTranslation `json:"translations"`
+}
+
+// checkDeleteThreshold refuses a sync that would delete more files or
+// strings than allowed, before anything is changed on paratranz.
+func checkDeleteThreshold(changes []assetChange) error {
+	files, strs := 0, 0
+	for _, c := range changes {
+		if c.action == actionDelete {
+			files++
+			strs += c.pf.Total
+		}
+	}
+
+	if allowMassDelete || (files <= maxDeleteFiles && strs <= maxDeleteStrings) {
+		return nil
+	}
+
+	return fmt.Errorf("refusing to delete %d files with %d strings, the limit is %d files or %d strings, rerun with -allow-mass-delete if this is intended",
+		files, strs, maxDeleteFiles, maxDeleteStrings)
+}
+
+// archiveFile downloads the translations of pf into dump/deleted/<date>/.
+func archiveFile(ctx context.Context, h *ParatranzHandler, pf ParatranzFile) (string, error) {
+	var trans []ParatranzTranslation
+
+	err := retryWithBackoff(ctx, func() error {
+		t, err := h.GetTranslation(ctx, pf.ID)
+		trans = t
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	now := time.Now()
+	b, err := JSONMarshal(deletedArchive{DeletedAt: now, File: pf, Translations: trans})
+	if err != nil {
+		return "", fmt.Errorf("JSONMarshal %s: %w", pf.Name, err)
+	}
+
+	archivePath := cfg.dumpPath("deleted", now.Format("2006-01-02"), pf.Name+".json")
+	os.MkdirAll(filepath.Dir(archivePath), os.ModePerm)
+	if err := os.WriteFile(archivePath, b, os.ModePerm); err != nil {
+		return "", fmt.Errorf("write archive %s: %w", archivePath, err)
+	}
+
+	return archivePath, nil
+}
+
+// latestArchive finds the most recent archive of a paratranz file name.
+func latestArchive(name string) (string, error) {
+	deletedRoot := cfg.dumpPath("deleted")
+	dates, err := os.ReadDir(deletedRoot)
+	if err != nil {
+		return "", err
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Name() > dates[j].Name() })
+
+	for _, date := range dates {
+		p := filepath.Join(deletedRoot, date.Name(), name+".json")
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("no archive of %s under %s: %w", name, deletedRoot, os.ErrNotExist)
+}
+
+// restoreDeletedFile uploads an archived file again, from the KR asset when
+// the game has re-added it, and puts its translations and stages back.
+func restoreDeletedFile(ctx context.Context, name string) error {
+	zap.S().Infoln("Start restore deleted file", name)
+
+	archivePath, err := latestArchive(name)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(archivePath)
+	if err != nil {
+		return err
+	}
+
+	archive := deletedArchive{}
+	if err := json.Unmarshal(b, &archive); err != nil {
+		return fmt.Errorf("read archive %s: %w", archivePath, err)
+	}
+
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
+	}
+
+	tranfolder, tranname := filepath.Dir(name), filepath.Base(name)
+
+	pf, has := m[name]
+	if !has {
+		data, err := restoreSource(archive, tranfolder, tranname)
+		if err != nil {
+			return err
+		}
+
+		var created *ParatranzFile
+		err = retryWithBackoff(ctx, func() error {
+			f, err := h.UploadFile(ctx, data, tranfolder, tranname)
+			created = f
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("UploadFile %s: %w", name, err)
+		}
+		pf = *created
+
+		if err := updateContext(ctx, h, pf, tranfolder, tranname); err != nil {
+			return err
+		}
+	} else {
+		zap.S().Infoln("file already on paratranz, restore translations only", name, pf.ID)
+	}
+
+	restore := []ParatranzTranslation{}
+	for _, t := range archive.Translations {
+		if t.Translation != "" || t.Stage != 0 {
+			restore = append(restore, t)
+		}
+	}
+
+	if len(restore) == 0 {
+		zap.S().Infoln("archive has no translations", archivePath)
+		return nil
+	}
+
+	tranb, err := JSONMarshal(restore)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal %s: %w", name, err)
+	}
+
+	err = retryWithBackoff(ctx, func() error {
+		return h.UpdateTranslation(ctx, pf.ID, tranb, pf.Name, true, true)
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateTranslation %s: %w", name, err)
+	}
+
+	zap.S().Infow("restored deleted file", "file", name, "id", pf.ID, "archive", archivePath, "translations", len(restore))
+	return nil
+}
+
+// restoreSource prefers the current KR asset and falls back to the archived
+// originals in paratranz's own format.
+func restoreSource(archive deletedArchive, tranfolder, tranname string) ([]byte, error) {
+	krPath := cfg.sourcePath(tranfolder, tranname)
+	_, err := os.Stat(krPath)
+	if err == nil {
+		_, pm, err := getPMData(krPath)
+		if err != nil {
+			return nil, err
+		}
+		return pm.uploadData()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	zap.S().Warnln("KR asset missing, restore originals from archive", krPath)
+
+	originals := []ParatranzTranslation{}
+	for _, t := range archive.Translations {
+		originals = append(originals, ParatranzTranslation{Key: t.Key, Original: t.Original, Context: t.Context})
+	}
+	return JSONMarshal(originals)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestMassDeleteCapAndRestore(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	list := ""
+	for _, name := range []string{"A.json", "B.json", "C.json"} {
+		srv.AddFile(1, "StoryData/"+name, []paratranztest.String{{Key: "dataList->0->content", Original: "원문", Translation: "译文", Stage: 5}})
+		list += "D\tkr/StoryData/KR_" + name + "\n"
+	}
+	os.MkdirAll("dump", os.ModePerm)
+	if err := os.WriteFile(filepath.Join("dump", "kr_files.txt"), []byte(list), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(files int) { maxDeleteFiles, allowMassDelete, syncFromLists = files, false, false }(maxDeleteFiles)
+	paraid, token, apiRoot, rateLimit, maxDeleteFiles, syncFromLists = 1, "test", srv.APIRoot(), 0, 2, true
+	ctx := context.Background()
+
+	err := updateFromAssets(ctx)
+	if err == nil || !strings.Contains(err.Error(), "-allow-mass-delete") {
+		t.Fatalf("updateFromAssets = %v, want the delete limit", err)
+	}
+	if n := len(srv.Files(1)); n != 3 {
+		t.Fatalf("%d files left after a refused sync, want all 3", n)
+	}
+
+	allowMassDelete = true
+	if err := updateFromAssets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Files(1)); n != 0 {
+		t.Fatalf("%d files left, want every file deleted", n)
+	}
+	if _, err := latestArchive("StoryData/B.json"); err != nil {
+		t.Fatalf("no archive of a deleted file: %v", err)
+	}
+
+	if err := restoreDeletedFile(ctx, "StoryData/B.json"); err != nil {
+		t.Fatal(err)
+	}
+	f, has := srv.Files(1)["StoryData/B.json"]
+	if !has {
+		t.Fatal("restore did not upload the file again")
+	}
+	strs := srv.Strings(1, f.ID)
+	if len(strs) != 1 || strs[0].Original != "원문" || strs[0].Translation != "译文" || strs[0].Stage != 5 {
+		t.Errorf("restored strings %+v, want the archived original, translation and stage", strs)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	artifactMaxAge     time.Duration
+	artifactRegenerate = false
+	artifactWait       = 30 * time.Minute
+)
+
+const artifactPollInterval = 15 * time.Second
+
+func artifactInfoPath(id int) string {
+	return filepath.Join(cfg.artifactDir(id), "artifact.json")
+}
+
+// artifactFresh reports whether an artifact is recent enough for
+// artifactMaxAge. With -regenerate and no -max-age none is.
+func artifactFresh(a *ParatranzArtifact) bool {
+	if artifactMaxAge <= 0 {
+		return !artifactRegenerate
+	}
+	return time.Since(a.CreatedAt) <= artifactMaxAge
+}
+
+// ensureArtifact keeps the extracted artifact of project id when it is
+// fresh, and downloads it again otherwise.
+func ensureArtifact(ctx context.Context, id int) error {
+	if b, err := os.ReadFile(artifactInfoPath(id)); err == nil {
+		local := ParatranzArtifact{}
+		if json.Unmarshal(b, &local) == nil && artifactFresh(&local) {
+			zap.S().Infow("use downloaded artifact", "project", id, "createdAt", local.CreatedAt)
+			return nil
+		}
+	}
+	return fetchArtifact(ctx, id)
+}
+
+// fetchArtifact downloads the artifact of project id into its artifactDir.
+// An artifact older than artifactMaxAge is generated again when
+// artifactRegenerate is set and refused otherwise.
+func fetchArtifact(ctx context.Context, id int) error {
+	h := newParatranzHandler(id)
+
+	var artifact *ParatranzArtifact
+	err := retryWithBackoff(ctx, func() error {
+		a, err := h.GetArtifact(ctx)
+		artifact = a
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("GetArtifact %d: %w", id, err)
+	}
+
+	if !artifactFresh(artifact) {
+		if !artifactRegenerate {
+			return fmt.Errorf("artifact of project %d was generated %s ago, over -max-age %s, rerun with -regenerate",
+				id, time.Since(artifact.CreatedAt).Round(time.Minute), artifactMaxAge)
+		}
+		artifact, err = regenerateArtifact(ctx, h, artifact)
+		if err != nil {
+			return err
+		}
+	}
+
+	zap.S().Infow("download artifact", "project", id, "createdAt", artifact.CreatedAt)
+
+	var data []byte
+	err = retryWithBackoff(ctx, func() error {
+		b, err := h.DownloadArtifact(ctx)
+		data = b
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("DownloadArtifact %d: %w", id, err)
+	}
+
+	if err := extractArtifact(data, cfg.artifactDir(id)); err != nil {
+		return fmt.Errorf("extract artifact %d: %w", id, err)
+	}
+
+	b, err := JSONMarshal(artifact)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal artifact: %w", err)
+	}
+	return os.WriteFile(artifactInfoPath(id), b, os.ModePerm)
+}
+
+// regenerateArtifact triggers a new artifact and waits until paratranz
+// reports one created after old.
+func regenerateArtifact(ctx context.Context, h *ParatranzHandler, old *ParatranzArtifact) (*ParatranzArtifact, error) {
+	zap.S().Infow("generate artifact", "project", h.id, "previous", old.CreatedAt)
+
+	err := retryWithBackoff(ctx, func() error {
+		return h.TriggerArtifact(ctx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("TriggerArtifact %d: %w", h.id, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, artifactWait)
+	defer cancel()
+
+	for {
+		var artifact *ParatranzArtifact
+		err := retryWithBackoff(ctx, func() error {
+			a, err := h.GetArtifact(ctx)
+			artifact = a
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetArtifact %d: %w", h.id, err)
+		}
+		if artifact.CreatedAt.After(old.CreatedAt) {
+			zap.S().Infow("artifact generated", "project", h.id, "createdAt", artifact.CreatedAt)
+			return artifact, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for artifact %d: %w", h.id, ctx.Err())
+		case <-time.After(artifactPollInterval):
+		}
+	}
+}
+
+// extractArtifact unpacks the zip into dir, replacing the raw folder of a
+// previous artifact. The utf8 copies paratranz adds are skipped.
+func extractArtifact(data []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "raw")); err != nil {
+		return err
+	}
+
+	files := 0
+	for _, zf := range zr.File {
+		name := path.Clean(strings.ReplaceAll(zf.Name, "\\", "/"))
+		if strings.HasPrefix(name, "utf8/") || zf.FileInfo().IsDir() {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("unsafe path %s in artifact", zf.Name)
+		}
+
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), os.ModePerm)
+		if err := extractZipFile(zf, p); err != nil {
+			return err
+		}
+		files++
+	}
+
+	zap.S().Infow("artifact extracted", "dir", dir, "files", files)
+	return nil
+}
+
+func extractZipFile(zf *zip.File, p string) error {
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArtifact(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "raw", "Old.json.json")
+	os.MkdirAll(filepath.Dir(stale), os.ModePerm)
+	os.WriteFile(stale, []byte("[]"), os.ModePerm)
+
+	data := zipFiles(t, map[string]string{
+		"raw/StoryData/A.json.json":  "[]",
+		`raw\UI\B.json.json`:         "[]",
+		"utf8/StoryData/A.json.json": "[]",
+	})
+	if err := extractArtifact(data, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, want := range map[string]bool{
+		filepath.Join("raw", "StoryData", "A.json.json"):  true,
+		filepath.Join("raw", "UI", "B.json.json"):         true,
+		filepath.Join("utf8", "StoryData", "A.json.json"): false,
+		filepath.Join("raw", "Old.json.json"):             false,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, p)); (err == nil) != want {
+			t.Errorf("%s exists %v, want %v", p, err == nil, want)
+		}
+	}
+
+	if err := extractArtifact(zipFiles(t, map[string]string{"../evil.json": "[]"}), dir); err == nil {
+		t.Error("artifact escaping the folder extracted, want an error")
+	}
+}
+
+func TestFetchArtifact(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() { artifactMaxAge, artifactRegenerate = 0, false }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+	ctx := context.Background()
+
+	srv.AddFile(1, "StoryData/A.json", []paratranztest.String{{Key: "a", Original: "x", Translation: "y", Stage: stageTranslated}})
+	old := time.Now().Add(-48 * time.Hour)
+	srv.SetArtifact(1, old)
+
+	artifactMaxAge = time.Hour
+	if err := fetchArtifact(ctx, 1); err == nil {
+		t.Fatal("artifact over -max-age downloaded, want a refusal")
+	}
+
+	artifactRegenerate = true
+	if err := ensureArtifact(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.artifactRaw(1), "StoryData", "A.json.json")); err != nil {
+		t.Fatalf("artifact not extracted: %v", err)
+	}
+
+	// a fresh local artifact is kept without asking paratranz
+	requests := len(srv.Requests())
+	if err := ensureArtifact(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Requests()); n != requests {
+		t.Errorf("%d requests for a fresh local artifact, want none", n-requests)
+	}
+}
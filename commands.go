@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// errUsage marks an error in the command line rather than in the run.
+var errUsage = errors.New("usage error")
+
+type command struct {
+	name  string
+	usage string
+	// args names the positional arguments the command takes
+	args []string
+	// writes marks commands changing translations, their runs are
+	// snapshotted for rollback
+	writes bool
+	setup  func(fs *flag.FlagSet)
+	run    func(ctx context.Context, fs *flag.FlagSet) error
+}
+
+var commands = []command{
+	{
+		name:   "sync",
+		usage:  "upload changed KR assets to paratranz and refresh EN/JP context",
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.BoolVar(&assetsContextUpdate, "update-context", false, "also refresh context of files only changed in EN or JP")
+			fs.BoolVar(&dryRun, "dry-run", false, "print the update plan without changing paratranz")
+			fs.IntVar(&maxDeleteFiles, "max-delete-files", maxDeleteFiles, "refuse a sync deleting more files than this")
+			fs.IntVar(&maxDeleteStrings, "max-delete-strings", maxDeleteStrings, "refuse a sync deleting more strings than this")
+			fs.BoolVar(&allowMassDelete, "allow-mass-delete", false, "allow a sync over the delete limits")
+			fs.StringVar(&syncBase, "base", "", "assets commit to diff from (default the last synced commit, or the parent of -head)")
+			fs.StringVar(&syncHead, "head", syncHead, "assets commit to diff to")
+			fs.BoolVar(&syncFromLists, "from-lists", false, "read the changed files from the dump file lists of scripts/list_all_file_to_change.sh instead of git")
+			fs.BoolVar(&resumeSync, "resume", false, "continue an unfinished sync from its last completed step")
+			fs.Float64Var(&shiftThreshold, "shift-threshold", shiftThreshold, "similarity from 0 to 1 a changed original needs to get a lost translation back as unreviewed")
+			fs.BoolVar(&incrementalSync, "incremental", false, "push only added, removed and changed strings instead of re-uploading whole files")
+			fs.BoolVar(&applyTM, "apply-tm", false, "fill untranslated strings of created files with exact translation memory matches")
+			fs.IntVar(&tmStage, "tm-stage", tmStage, "stage given to strings filled from the translation memory")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			switch tmStage {
+			case stageTranslated, stageChecked, stageReviewed:
+			default:
+				return fmt.Errorf("%w: -tm-stage must be %d, %d or %d", errUsage, stageTranslated, stageChecked, stageReviewed)
+			}
+			return updateFromAssets(ctx)
+		},
+	},
+	{
+		name:  "export",
+		usage: "build the language files under the configured export folder",
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.IntVar(&paraid2, "id2", 0, "second paratranz project whose artifact fills strings missing from -id")
+			fs.StringVar(&exportLang, "lang", "en", "fallback language for untranslated files, the source or a context language")
+			fs.BoolVar(&exportWithArtifact, "from-artifact", false, "export from the downloaded artifacts instead of the api")
+			artifactFlags(fs)
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			lang := strings.ToLower(exportLang)
+			if exportWithArtifact {
+				return exportAssetsWithArtifact(ctx, lang, paraid, paraid2)
+			}
+			return exportAssets(ctx, lang)
+		},
+	},
+	{
+		name:  "validate",
+		usage: "check the export against its assets, exits 1 when a file differs in more than its strings",
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&configPath, "config", defaultConfigPath, "project configuration file")
+			fs.StringVar(&validateLang, "lang", validateLang, "language whose file list must be exported and whose assets are used without a source file")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return validateExport(ctx)
+		},
+	},
+	{
+		name:  "artifact",
+		usage: "download the project artifact into <downloadDir>/<id>/raw",
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			artifactFlags(fs)
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return fetchArtifact(ctx, paraid)
+		},
+	},
+	{
+		name:  "package",
+		usage: "zip the export into the CLT_only_text, CLT_complete and localize_files release archives",
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&configPath, "config", defaultConfigPath, "project configuration file")
+			fs.StringVar(&packageFolder, "folder", "", "language folder name inside the zips (default exportFolder)")
+			fs.StringVar(&packageFont, "font", "", "font placed under Font/Context and Font/Title, CLT_complete is only built with one")
+			fs.StringVar(&packageVersion, "version", "", "suffix of the zip names")
+			fs.StringVar(&packageOut, "out", packageOut, "folder the zips and manifest.json are written to")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return buildPackages(ctx)
+		},
+	},
+	{
+		name:  "release-notes",
+		usage: "write the release notes: the hand-written notes, what changed since the last release and the progress",
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.BoolVar(&releaseFromArtifact, "from-artifact", false, "read the strings from the downloaded artifact of -id instead of the api")
+			fs.StringVar(&releasePrevious, "previous", "", "snapshot of the previous release (default <dumpDir>/release_snapshot.json)")
+			fs.StringVar(&releaseOut, "out", releaseOut, "markdown file the notes are appended to")
+			fs.StringVar(&releaseNotesFile, "notes-file", releaseNotesFile, "paratranz file holding the "+releaseNotesKey+" string")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return buildReleaseNotes(ctx)
+		},
+	},
+	{
+		name:   "replace",
+		usage:  "find and replace in the translations of the project, previewed and reverted with rollback <run-id>",
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.StringVar(&replacefile, "file", "", "replace rules, a .json rule list or one literal from|to per line")
+			fs.BoolVar(&dryRun, "dry-run", false, "only print the preview")
+			fs.BoolVar(&replaceYes, "yes", false, "apply without asking for confirmation")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			if replacefile == "" {
+				return fmt.Errorf("%w: -file is required", errUsage)
+			}
+			return replaceFromFile(ctx, replacefile)
+		},
+	},
+	{
+		name:  "untranslated",
+		usage: "dump untranslated StoryData strings to <dumpDir>/UT",
+		setup: projectFlags,
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return exportUntranslateStory(ctx)
+		},
+	},
+	{
+		name:   "copy-translations",
+		usage:  "copy translations of unfinished files from another project",
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.IntVar(&syncid, "from", 0, "paratranz project to copy translations from")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			if syncid == 0 {
+				return fmt.Errorf("%w: -from is required", errUsage)
+			}
+			return syncTran(ctx)
+		},
+	},
+	{
+		name:   "reset-eol",
+		usage:  "re-upload files and translations listed in a file to reset their line endings",
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.StringVar(&eolList, "list", "", "artifact files to re-upload, one path per line (default <dumpDir>/space_files.txt)")
+			fs.StringVar(&eolArtifactRoot, "artifact-root", "", "prefix stripped from listed paths to get the paratranz name (default <downloadDir>/raw/)")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return resetEOL(ctx)
+		},
+	},
+	{
+		name:   "migrate-keys",
+		usage:  "re-key every paratranz file to the keyStrategy of the config, keeping translations and stages",
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.StringVar(&migrateFrom, "from", migrateFrom, "key strategy the project uses now: index or id")
+			fs.BoolVar(&dryRun, "dry-run", false, "only report how many strings would be re-keyed")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return migrateKeys(ctx)
+		},
+	},
+	{
+		name:   "rollback",
+		usage:  "put back the translations and strings a run changed and delete the files it created, from its snapshot in <dumpDir>/runs",
+		args:   []string{"run-id"},
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.BoolVar(&rollbackForce, "force", false, "also restore strings edited after the run")
+			fs.BoolVar(&dryRun, "dry-run", false, "only report what would be restored")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return rollback(ctx, fs.Arg(0))
+		},
+	},
+	{
+		name:  "tm-build",
+		usage: "add the project translations to the translation memory <dumpDir>/tm.json, replacing an earlier build from the same source",
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.BoolVar(&tmFromArtifact, "from-artifact", false, "build from the downloaded artifact of -id instead of the api")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			return buildTM(ctx)
+		},
+	},
+	{
+		name:  "tm-query",
+		usage: "print the translation memory entries of a source text",
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&configPath, "config", defaultConfigPath, "project configuration file")
+			fs.StringVar(&tmText, "text", "", "source text to look up")
+			fs.BoolVar(&tmContains, "contains", false, "list every original containing -text")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			if tmText == "" {
+				return fmt.Errorf("%w: -text is required", errUsage)
+			}
+			return queryTM(ctx)
+		},
+	},
+	{
+		name:  "glossary-sync",
+		usage: "make the project glossary terms match a CSV or TSV glossary file",
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.StringVar(&glossaryFile, "file", "", "glossary with the columns term, translation and note, .tsv files are tab separated")
+			fs.BoolVar(&glossaryPrune, "prune", false, "delete project terms missing from the file")
+			fs.BoolVar(&dryRun, "dry-run", false, "only log the changes")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			if glossaryFile == "" {
+				return fmt.Errorf("%w: -file is required", errUsage)
+			}
+			return syncGlossary(ctx)
+		},
+	},
+	{
+		name:  "glossary-check",
+		usage: "report translations not using the agreed translation of a glossary term",
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.StringVar(&glossaryFile, "file", "", "glossary with the columns term, translation and note, .tsv files are tab separated")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			if glossaryFile == "" {
+				return fmt.Errorf("%w: -file is required", errUsage)
+			}
+			return checkGlossary(ctx)
+		},
+	},
+	{
+		name:   "restore-deleted",
+		usage:  "re-upload an archived deleted file and its translations",
+		writes: true,
+		setup: func(fs *flag.FlagSet) {
+			projectFlags(fs)
+			fs.StringVar(&restoreDeleted, "file", "", "paratranz file name, e.g. StoryData/xxx.json")
+		},
+		run: func(ctx context.Context, fs *flag.FlagSet) error {
+			if restoreDeleted == "" {
+				return fmt.Errorf("%w: -file is required", errUsage)
+			}
+			return restoreDeletedFile(ctx, restoreDeleted)
+		},
+	},
+}
+
+// projectFlags are shared by every command talking to paratranz.
+func projectFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configPath, "config", defaultConfigPath, "project configuration file")
+	fs.IntVar(&paraid, "id", 0, "paratranz project id")
+	fs.StringVar(&token, "token", os.Getenv("PARATRANZ_TOKEN"), "paratranz token (env PARATRANZ_TOKEN)")
+	fs.StringVar(&apiRoot, "api-root", envOr("PARATRANZ_API_ROOT", paratranzAPIRoot), "paratranz api root url (env PARATRANZ_API_ROOT)")
+	fs.DurationVar(&runTimeout, "timeout", 0, "deadline for the whole run, 0 means no deadline")
+	fs.DurationVar(&requestTimeout, "request-timeout", paratranzRequestTimeout, "deadline for a single paratranz request")
+	fs.Float64Var(&rateLimit, "rate-limit", paratranzRateLimit, "paratranz requests per second, 0 disables the limiter")
+	fs.IntVar(&retryMaxAttempts, "max-retries", retryMaxAttempts, "attempts per request on rate limit, 5xx or network errors")
+	fs.IntVar(&concurrency, "concurrency", concurrency, "number of files processed in parallel")
+}
+
+// artifactFlags control the age of the artifacts a command downloads.
+func artifactFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&artifactMaxAge, "max-age", 0, "refuse artifacts generated longer ago than this, 0 accepts any age")
+	fs.BoolVar(&artifactRegenerate, "regenerate", false, "generate a new artifact instead of refusing an old one, always without -max-age")
+	fs.DurationVar(&artifactWait, "wait", artifactWait, "how long to wait for a generated artifact")
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ParatranzUploader <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `run "ParatranzUploader <command> -h" for the flags of a command`)
+}
+
+// parseCommand resolves the command and its flags, it returns the exit code
+// to stop with when the command line is not runnable.
+func parseCommand(args []string) (*command, *flag.FlagSet, int) {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return nil, nil, exitUsage
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return nil, nil, exitOK
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return nil, nil, exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		args := ""
+		for _, a := range cmd.args {
+			args += " <" + a + ">"
+		}
+		fmt.Fprintf(fs.Output(), "usage: ParatranzUploader %s [flags]%s\n\n%s\n\nflags:\n", cmd.name, args, cmd.usage)
+		fs.PrintDefaults()
+	}
+	if cmd.setup != nil {
+		cmd.setup(fs)
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, exitOK
+		}
+		return nil, nil, exitUsage
+	}
+
+	if fs.NArg() > len(cmd.args) {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n\n", strings.Join(fs.Args()[len(cmd.args):], " "))
+		fs.Usage()
+		return nil, nil, exitUsage
+	}
+	if fs.NArg() < len(cmd.args) {
+		fmt.Fprintf(os.Stderr, "missing arguments: %s\n\n", strings.Join(cmd.args[fs.NArg():], " "))
+		fs.Usage()
+		return nil, nil, exitUsage
+	}
+
+	return cmd, fs, exitOK
+}
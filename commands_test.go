@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestParseCommand(t *testing.T) {
+	defer func(id int) { paraid = id }(paraid)
+
+	tests := []struct {
+		args []string
+		cmd  string
+		code int
+	}{
+		{nil, "", exitUsage},
+		{[]string{"help"}, "", exitOK},
+		{[]string{"upload"}, "", exitUsage},
+		{[]string{"sync", "-h"}, "", exitOK},
+		{[]string{"sync", "-no-such-flag"}, "", exitUsage},
+		{[]string{"sync", "extra"}, "", exitUsage},
+		{[]string{"sync", "-id", "3", "-dry-run"}, "sync", exitOK},
+	}
+
+	for _, tt := range tests {
+		cmd, _, code := parseCommand(tt.args)
+		name := ""
+		if cmd != nil {
+			name = cmd.name
+		}
+		if name != tt.cmd || code != tt.code {
+			t.Errorf("parseCommand(%q) = %q, %d, want %q, %d", tt.args, name, code, tt.cmd, tt.code)
+		}
+	}
+
+	if paraid != 3 || !dryRun {
+		t.Errorf("sync flags gave id %d dry-run %v, want 3 and true", paraid, dryRun)
+	}
+	dryRun = false
+}
+
+func TestRunMain(t *testing.T) {
+	defer func() { currentRun = nil }()
+	chdir(t, t.TempDir())
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	project := []string{"-id", "1", "-token", "test", "-api-root", srv.APIRoot(), "-rate-limit", "0"}
+
+	if code := runMain(append([]string{"replace"}, project...)); code != exitUsage {
+		t.Errorf("replace without -file exited with %d, want %d", code, exitUsage)
+	}
+
+	if code := runMain(append([]string{"sync", "-from-lists"}, project...)); code != exitFailure {
+		t.Errorf("sync without file lists exited with %d, want %d", code, exitFailure)
+	}
+
+	writeAsset(t, "Assets", "kr", "Test.json", "안녕")
+	os.MkdirAll("dump", os.ModePerm)
+	if err := os.WriteFile(filepath.Join("dump", "kr_files.txt"), []byte("A\tkr/StoryData/KR_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if code := runMain(append([]string{"sync", "-from-lists"}, project...)); code != exitOK {
+		t.Fatalf("sync exited with %d", code)
+	}
+	if _, has := srv.Files(1)["StoryData/Test.json"]; !has {
+		t.Errorf("sync did not create the file, have %v", srv.Files(1))
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultConfigPath = "paratranz.json"
+
+// projectConfig describes one translation project, see config.schema.json.
+// Every field left out of the file keeps the value of defaultConfig.
+type projectConfig struct {
+	Schema             string            `json:"$schema,omitempty"`
+	SourceLang         string            `json:"sourceLang"`
+	ContextLangs       []string          `json:"contextLangs"`
+	FilePrefixes       map[string]string `json:"filePrefixes,omitempty"`
+	AssetsRoot         string            `json:"assetsRoot"`
+	DumpDir            string            `json:"dumpDir"`
+	DownloadDir        string            `json:"downloadDir"`
+	ExportRoot         string            `json:"exportRoot"`
+	ExportFolder       string            `json:"exportFolder"`
+	KeyStrategy        string            `json:"keyStrategy"`
+	HotfixFile         string            `json:"hotfixFile"`
+	ProjectID          int               `json:"projectId,omitempty"`
+	SecondaryProjectID int               `json:"secondaryProjectId,omitempty"`
+}
+
+var (
+	configPath = defaultConfigPath
+	cfg        = defaultConfig()
+)
+
+func defaultConfig() projectConfig {
+	return projectConfig{
+		SourceLang:   "kr",
+		ContextLangs: []string{"en", "jp"},
+		AssetsRoot:   "Assets",
+		DumpDir:      "dump",
+		DownloadDir:  "download",
+		ExportRoot:   "export/LimbusCompany_Data/Lang",
+		ExportFolder: "TW",
+		KeyStrategy:  keyByIndex,
+		HotfixFile:   "hotfix.json",
+	}
+}
+
+// loadConfig reads path over the defaults. A missing file is only an error
+// when the user asked for it explicitly.
+func loadConfig(path string, explicit bool) (projectConfig, error) {
+	c := defaultConfig()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return c, nil
+		}
+		return c, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	if err := c.validate(); err != nil {
+		return c, fmt.Errorf("config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c projectConfig) validate() error {
+	if c.SourceLang == "" {
+		return errors.New("sourceLang is required")
+	}
+	if slices.Contains(c.ContextLangs, c.SourceLang) {
+		return fmt.Errorf("contextLangs must not contain the source language %q", c.SourceLang)
+	}
+	if c.ExportFolder == "" || strings.ContainsAny(c.ExportFolder, `/\`) {
+		return fmt.Errorf("exportFolder %q must be a single folder name", c.ExportFolder)
+	}
+	if c.KeyStrategy != keyByIndex && c.KeyStrategy != keyByID {
+		return fmt.Errorf("keyStrategy %q must be %s or %s", c.KeyStrategy, keyByIndex, keyByID)
+	}
+	for name, dir := range map[string]string{"assetsRoot": c.AssetsRoot, "dumpDir": c.DumpDir, "downloadDir": c.DownloadDir, "exportRoot": c.ExportRoot} {
+		if dir == "" {
+			return fmt.Errorf("%s must not be empty", name)
+		}
+	}
+	return nil
+}
+
+// langs is the source language followed by the context languages in order.
+func (c projectConfig) langs() []string {
+	return append([]string{c.SourceLang}, c.ContextLangs...)
+}
+
+// prefix is the file name prefix of a language in the assets, like KR_.
+func (c projectConfig) prefix(lang string) string {
+	if p, has := c.FilePrefixes[lang]; has {
+		return p
+	}
+	return strings.ToUpper(lang) + "_"
+}
+
+func (c projectConfig) assetPath(lang, folder, name string) string {
+	return filepath.Join(c.AssetsRoot, lang, folder, c.prefix(lang)+name)
+}
+
+func (c projectConfig) sourcePath(folder, name string) string {
+	return c.assetPath(c.SourceLang, folder, name)
+}
+
+// fileList is the file list of a language written by
+// scripts/list_all_file_to_change.sh.
+func (c projectConfig) fileList(lang string) string {
+	return filepath.Join(c.DumpDir, lang+"_files.txt")
+}
+
+func (c projectConfig) dumpPath(elem ...string) string {
+	return filepath.Join(append([]string{c.DumpDir}, elem...)...)
+}
+
+// artifactDir is where the artifact of project id is extracted.
+func (c projectConfig) artifactDir(id int) string {
+	return filepath.Join(c.DownloadDir, strconv.Itoa(id))
+}
+
+func (c projectConfig) artifactRaw(id int) string {
+	return filepath.Join(c.artifactDir(id), "raw")
+}
+
+func (c projectConfig) exportDir() string {
+	return filepath.Join(c.ExportRoot, c.ExportFolder)
+}
+
+// applyConfig loads the -config file of a parsed command and fills the
+// project ids the command line left out.
+func applyConfig(fs *flag.FlagSet) error {
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			explicit = true
+		}
+	})
+
+	c, err := loadConfig(configPath, explicit)
+	if err != nil {
+		return err
+	}
+	cfg = c
+
+	if paraid == 0 {
+		paraid = cfg.ProjectID
+	}
+	if paraid2 == 0 {
+		paraid2 = cfg.SecondaryProjectID
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func writeConfig(t *testing.T, path string, v any) {
+	t.Helper()
+
+	b, _ := json.Marshal(v)
+	if err := os.WriteFile(path, b, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.json")
+
+	if c, err := loadConfig(missing, false); err != nil || c.SourceLang != "kr" {
+		t.Errorf("implicit missing config = %+v, %v, want the defaults", c, err)
+	}
+	if _, err := loadConfig(missing, true); err == nil {
+		t.Error("explicit missing config loaded, want an error")
+	}
+
+	p := filepath.Join(dir, "paratranz.json")
+	writeConfig(t, p, map[string]any{"contextLangs": []string{"en"}, "projectId": 7})
+	c, err := loadConfig(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ProjectID != 7 || len(c.ContextLangs) != 1 || c.DumpDir != "dump" {
+		t.Errorf("config %+v, want the file over the defaults", c)
+	}
+
+	for _, bad := range []map[string]any{
+		{"sourceLang": "kr", "contextLangs": []string{"kr"}},
+		{"exportFolder": "a/b"},
+		{"dumpDir": ""},
+		{"unknown": true},
+	} {
+		writeConfig(t, p, bad)
+		if _, err := loadConfig(p, true); err == nil {
+			t.Errorf("config %v loaded, want an error", bad)
+		}
+	}
+}
+
+func TestConfigPaths(t *testing.T) {
+	c := defaultConfig()
+	c.AssetsRoot = "/game"
+	c.FilePrefixes = map[string]string{"jp": "JA_"}
+
+	if got := c.sourcePath("StoryData", "A.json"); got != filepath.Join("/game", "kr", "StoryData", "KR_A.json") {
+		t.Errorf("sourcePath = %s", got)
+	}
+	if got := c.assetPath("jp", "StoryData", "A.json"); got != filepath.Join("/game", "jp", "StoryData", "JA_A.json") {
+		t.Errorf("assetPath with a prefix override = %s", got)
+	}
+	if got := c.exportDir(); got != filepath.Join("export", "LimbusCompany_Data", "Lang", "TW") {
+		t.Errorf("exportDir = %s", got)
+	}
+}
+
+func TestRunMainConfig(t *testing.T) {
+	defer func() { currentRun = nil }()
+	dir := t.TempDir()
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	defer func() { cfg = defaultConfig() }()
+
+	config := filepath.Join(dir, "paratranz.json")
+	writeConfig(t, config, map[string]any{
+		"assetsRoot":   filepath.Join(dir, "game"),
+		"dumpDir":      filepath.Join(dir, "lists"),
+		"contextLangs": []string{"en"},
+		"projectId":    4,
+	})
+
+	writeAsset(t, filepath.Join(dir, "game"), "kr", "Test.json", "안녕")
+	writeAsset(t, filepath.Join(dir, "game"), "en", "Test.json", "Hello")
+	os.MkdirAll(filepath.Join(dir, "lists"), os.ModePerm)
+	if err := os.WriteFile(filepath.Join(dir, "lists", "kr_files.txt"), []byte("A\tkr/StoryData/KR_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	code := runMain([]string{"sync", "-config", config, "-token", "test", "-api-root", srv.APIRoot(), "-rate-limit", "0", "-from-lists"})
+	if code != exitOK {
+		t.Fatalf("sync exited with %d", code)
+	}
+
+	f, has := srv.Files(4)["StoryData/Test.json"]
+	if !has {
+		t.Fatalf("sync did not create the file in the configured project, have %v", srv.Files(4))
+	}
+	if strs := srv.Strings(4, f.ID); len(strs) == 0 || strings.Contains(strs[len(strs)-1].Context, "JP") {
+		t.Errorf("strings %+v, want context from EN only", strs)
+	}
+}
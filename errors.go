@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const paratranzStatusEmpty = "empty"
+
+var (
+	ErrRateLimited  = errors.New("paratranz rate limited")
+	ErrEmptyFile    = errors.New("paratranz skipped empty file")
+	ErrNotFound     = errors.New("paratranz resource not found")
+	ErrUnauthorized = errors.New("paratranz unauthorized")
+	ErrReadOnly     = errors.New("paratranz handler is read only")
+)
+
+// APIError is any non-200 answer from paratranz. It matches ErrRateLimited,
+// ErrNotFound and ErrUnauthorized through errors.Is by status code.
+type APIError struct {
+	StatusCode int
+	Body       string
+	Endpoint   string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	body := strings.TrimSpace(e.Body)
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return fmt.Sprintf("%s: status %d: %s", e.Endpoint, e.StatusCode, body)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
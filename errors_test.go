@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestAPIErrors(t *testing.T) {
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	srv.Token = "token"
+	ctx := context.Background()
+
+	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()), WithRateLimit(0, 0))
+
+	if _, err := h.GetTranslation(ctx, 42); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTranslation of a missing file = %v, want ErrNotFound", err)
+	}
+
+	if _, err := h.UploadFile(ctx, []byte(`{"dataList": []}`), "StoryData", "Empty.json"); !errors.Is(err, ErrEmptyFile) {
+		t.Errorf("UploadFile of an empty file = %v, want ErrEmptyFile", err)
+	}
+
+	srv.InjectFault(paratranztest.Fault{Status: http.StatusTooManyRequests, Body: "slow down", Times: 1})
+	_, err := h.GetFiles(ctx)
+	var apiErr *APIError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.Endpoint != "GET /projects/1/files" {
+		t.Errorf("GetFiles on 429 = %v, want ErrRateLimited naming the endpoint", err)
+	}
+
+	bad := NewParatranzHandler(1, "wrong", WithAPIRoot(srv.APIRoot()), WithRateLimit(0, 0))
+	if _, err := bad.GetFiles(ctx); !errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFiles with a wrong token = %v, want ErrUnauthorized", err)
+	}
+}
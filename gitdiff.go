@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+var (
+	syncBase      = ""
+	syncHead      = "HEAD"
+	syncFromLists = false
+)
+
+// fileStatus is one line of git's --name-status output. from is only set
+// for renames.
+type fileStatus struct {
+	status byte
+	path   string
+	from   string
+}
+
+// parseNameStatus reads lines like "M\tkr/a.json" or "R100\tkr/a.json\tkr/b.json".
+// Copies are treated as additions of the new path, type changes as edits.
+func parseNameStatus(line string) (fileStatus, error) {
+	sp := strings.Split(line, "\t")
+	if len(sp) < 2 || sp[0] == "" {
+		return fileStatus{}, fmt.Errorf("bad name status line %q", line)
+	}
+
+	switch sp[0][0] {
+	case 'A', 'M', 'D':
+		return fileStatus{status: sp[0][0], path: sp[1]}, nil
+	case 'T':
+		return fileStatus{status: 'M', path: sp[1]}, nil
+	case 'R', 'C':
+		if len(sp) < 3 {
+			return fileStatus{}, fmt.Errorf("bad name status line %q", line)
+		}
+		if sp[0][0] == 'C' {
+			return fileStatus{status: 'A', path: sp[2]}, nil
+		}
+		return fileStatus{status: 'R', path: sp[2], from: sp[1]}, nil
+	}
+	return fileStatus{}, fmt.Errorf("unknown status %q in %q", sp[0], line)
+}
+
+// groupByLang parses name status lines and files them under the language
+// folder they live in. A rename between two languages becomes a delete and
+// an add.
+func groupByLang(lines []string) (map[string][]fileStatus, error) {
+	files := map[string][]fileStatus{}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		fst, err := parseNameStatus(line)
+		if err != nil {
+			return nil, err
+		}
+
+		lang := langOf(fst.path)
+		if fst.status == 'R' && langOf(fst.from) != lang {
+			files[langOf(fst.from)] = append(files[langOf(fst.from)], fileStatus{status: 'D', path: fst.from})
+			fst = fileStatus{status: 'A', path: fst.path}
+		}
+		files[lang] = append(files[lang], fst)
+	}
+	return files, nil
+}
+
+func langOf(path string) string {
+	lang, _, _ := strings.Cut(path, "/")
+	return lang
+}
+
+// changedFiles lists the changed assets per language, from the git history
+// of the assets repository or from the file lists of -from-lists. It also
+// returns the head commit to record once the sync went through.
+func changedFiles(ctx context.Context) (map[string][]fileStatus, string, error) {
+	if syncFromLists {
+		files, err := readFileLists()
+		return files, "", err
+	}
+
+	repo := cfg.AssetsRoot
+	head, err := gitRevParse(ctx, repo, syncHead)
+	if err != nil {
+		return nil, "", err
+	}
+
+	base := syncBase
+	if base == "" {
+		base, err = lastSyncedCommit()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if base == "" {
+		zap.S().Warnln("no synced commit recorded, diff against the parent of", head)
+		base = head + "^"
+	}
+
+	base, err = gitRevParse(ctx, repo, base)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w, the assets repository may be a shallow clone missing it", err)
+	}
+
+	zap.S().Infow("diff assets", "repo", repo, "base", base, "head", head)
+
+	out, err := git(ctx, repo, "-c", "core.quotepath=off", "diff", "--name-status", "--relative", "-M", base, head)
+	if err != nil {
+		return nil, "", err
+	}
+
+	files, err := groupByLang(strings.Split(string(out), "\n"))
+	return files, head, err
+}
+
+// readFileLists reads the dump file lists written by
+// scripts/list_all_file_to_change.sh, which lists every asset of a language
+// with one status, M by default, in the same name status format.
+func readFileLists() (map[string][]fileStatus, error) {
+	langs := []string{cfg.SourceLang}
+	if assetsContextUpdate {
+		langs = cfg.langs()
+	}
+
+	files := map[string][]fileStatus{}
+	for _, lang := range langs {
+		listpath := cfg.fileList(lang)
+		b, err := os.ReadFile(listpath)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", listpath, err)
+		}
+
+		langFiles, err := groupByLang(strings.Split(string(b), "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", listpath, err)
+		}
+		for l, fs := range langFiles {
+			files[l] = append(files[l], fs...)
+		}
+	}
+	return files, nil
+}
+
+func git(ctx context.Context, repo string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func gitRevParse(ctx context.Context, repo, rev string) (string, error) {
+	out, err := git(ctx, repo, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown commit %q in %s: %w", rev, repo, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func lastSyncedPath() string {
+	return cfg.dumpPath("last_synced_commit.txt")
+}
+
+// lastSyncedCommit is the head of the last sync that finished without
+// errors, or "" before the first one.
+func lastSyncedCommit() (string, error) {
+	f, err := os.Open(lastSyncedPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	if sc.Scan() {
+		return strings.TrimSpace(sc.Text()), nil
+	}
+	return "", sc.Err()
+}
+
+func recordSyncedCommit(commit string) error {
+	if commit == "" {
+		return nil
+	}
+
+	p := lastSyncedPath()
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err := os.WriteFile(p, []byte(commit+"\n"), os.ModePerm); err != nil {
+		return fmt.Errorf("record synced commit: %w", err)
+	}
+
+	zap.S().Infoln("synced up to", commit)
+	return nil
+}
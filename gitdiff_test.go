@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestParseNameStatus(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    fileStatus
+		wantErr bool
+	}{
+		{line: "A\tkr/a.json", want: fileStatus{status: 'A', path: "kr/a.json"}},
+		{line: "M\tkr/a.json", want: fileStatus{status: 'M', path: "kr/a.json"}},
+		{line: "D\tkr/a.json", want: fileStatus{status: 'D', path: "kr/a.json"}},
+		{line: "T\tkr/a.json", want: fileStatus{status: 'M', path: "kr/a.json"}},
+		{line: "R100\tkr/a.json\tkr/b.json", want: fileStatus{status: 'R', path: "kr/b.json", from: "kr/a.json"}},
+		{line: "C075\tkr/a.json\tkr/b.json", want: fileStatus{status: 'A', path: "kr/b.json"}},
+		{line: "R100\tkr/a.json", wantErr: true},
+		{line: "kr/a.json", wantErr: true},
+		{line: "\tkr/a.json", wantErr: true},
+		{line: "X\tkr/a.json", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseNameStatus(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNameStatus(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseNameStatus(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByLang(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    map[string][]fileStatus
+		wantErr bool
+	}{
+		{
+			name:  "empty lines",
+			lines: []string{"", ""},
+			want:  map[string][]fileStatus{},
+		},
+		{
+			name:  "by language",
+			lines: []string{"M\tkr/a.json", "A\ten/b.json", "D\tkr/c.json", ""},
+			want: map[string][]fileStatus{
+				"kr": {{status: 'M', path: "kr/a.json"}, {status: 'D', path: "kr/c.json"}},
+				"en": {{status: 'A', path: "en/b.json"}},
+			},
+		},
+		{
+			name:  "rename within a language",
+			lines: []string{"R090\tkr/a.json\tkr/sub/a.json"},
+			want: map[string][]fileStatus{
+				"kr": {{status: 'R', path: "kr/sub/a.json", from: "kr/a.json"}},
+			},
+		},
+		{
+			name:  "rename across languages",
+			lines: []string{"R100\ten/a.json\tkr/a.json"},
+			want: map[string][]fileStatus{
+				"en": {{status: 'D', path: "en/a.json"}},
+				"kr": {{status: 'A', path: "kr/a.json"}},
+			},
+		},
+		{
+			name:    "bad line",
+			lines:   []string{"M\tkr/a.json", "?"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := groupByLang(tt.lines)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("groupByLang error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupByLang = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyncFromGit syncs two commits of an assets repository, the second
+// renames a translated file.
+func TestSyncFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	assets := filepath.Join(dir, "Assets")
+	os.MkdirAll(assets, os.ModePerm)
+	if out, err := exec.Command("git", "init", "-q", assets).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	gitCommit(t, assets, "empty")
+
+	config := filepath.Join(dir, "paratranz.json")
+	writeConfig(t, config, map[string]string{"assetsRoot": assets, "dumpDir": filepath.Join(dir, "dump")})
+	defer func() { cfg = defaultConfig() }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+
+	writeAsset(t, assets, "kr", "Old.json", "안녕")
+	gitCommit(t, assets, "add Old")
+	runCommand(t, srv, config, "sync")
+
+	f, has := srv.Files(1)["StoryData/Old.json"]
+	if !has {
+		t.Fatalf("file not created, have %v", srv.Files(1))
+	}
+	h := NewParatranzHandler(1, "test", WithAPIRoot(srv.APIRoot()))
+	tb, _ := json.Marshal([]ParatranzTranslation{{Key: "dataList->0->content", Translation: "你好", Stage: 5}})
+	if err := h.UpdateTranslation(context.Background(), f.ID, tb, f.Name, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := exec.Command("git", "-C", assets, "mv", "kr/StoryData/KR_Old.json", "kr/StoryData/KR_New.json").CombinedOutput(); err != nil {
+		t.Fatalf("git mv: %v: %s", err, out)
+	}
+	gitCommit(t, assets, "rename Old")
+	runCommand(t, srv, config, "sync")
+
+	files := srv.Files(1)
+	moved, has := files["StoryData/New.json"]
+	if _, old := files["StoryData/Old.json"]; old || !has {
+		t.Fatalf("files after the rename %v, want only New.json", files)
+	}
+	if strs := srv.Strings(1, moved.ID); len(strs) == 0 || strs[len(strs)-1].Translation != "你好" {
+		t.Errorf("renamed file strings %+v, want the translation kept", strs)
+	}
+
+	head, err := git(context.Background(), assets, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced, _ := lastSyncedCommit(); synced != strings.TrimSpace(string(head)) {
+		t.Errorf("last synced commit %q, want HEAD %q", synced, head)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	glossaryFile  = ""
+	glossaryPrune = false
+)
+
+// readGlossary reads a CSV file, or a TSV file by its extension, with the
+// columns term, translation and an optional note. A header row starting
+// with "term", blank lines and lines starting with # are skipped.
+func readGlossary(path string) ([]ParatranzTerm, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+
+	terms := []ParatranzTerm{}
+	seen := map[string]int{}
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read glossary %s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+
+		for i := range rec {
+			rec[i] = strings.TrimSpace(strings.TrimPrefix(rec[i], "\ufeff"))
+		}
+		if len(rec) == 1 && rec[0] == "" {
+			continue
+		}
+		if len(terms) == 0 && strings.EqualFold(rec[0], "term") {
+			continue
+		}
+		if len(rec) < 2 || rec[0] == "" || rec[1] == "" {
+			return nil, fmt.Errorf("glossary %s:%d: want term, translation and an optional note", path, line)
+		}
+		if prev, has := seen[rec[0]]; has {
+			return nil, fmt.Errorf("glossary %s:%d: term %q already on line %d", path, line, rec[0], prev)
+		}
+		seen[rec[0]] = line
+
+		t := ParatranzTerm{Term: rec[0], Translation: rec[1]}
+		if len(rec) > 2 {
+			t.Note = rec[2]
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// syncGlossary makes the project terms match the glossary file. Terms only
+// on paratranz are kept unless glossaryPrune is set.
+func syncGlossary(ctx context.Context) error {
+	local, err := readGlossary(glossaryFile)
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infoln("Start sync glossary", glossaryFile, "to project", paraid)
+
+	h := newParatranzHandler(paraid)
+
+	var remote []ParatranzTerm
+	err = retryWithBackoff(ctx, func() error {
+		t, err := h.GetTerms(ctx)
+		remote = t
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("GetTerms %d: %w", paraid, err)
+	}
+
+	current := map[string]ParatranzTerm{}
+	for _, t := range remote {
+		if _, has := current[t.Term]; !has {
+			current[t.Term] = t
+		}
+	}
+
+	created, updated, deleted := 0, 0, 0
+	wanted := map[string]bool{}
+	for _, t := range local {
+		wanted[t.Term] = true
+
+		cur, has := current[t.Term]
+		switch {
+		case !has:
+			created++
+			zap.S().Infow("create term", "term", t.Term, "translation", t.Translation)
+			if dryRun {
+				continue
+			}
+			err = retryWithBackoff(ctx, func() error {
+				_, err := h.CreateTerm(ctx, t)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("CreateTerm %s: %w", t.Term, err)
+			}
+		case cur.Translation != t.Translation || cur.Note != t.Note:
+			updated++
+			zap.S().Infow("update term", "term", t.Term, "from", cur.Translation, "to", t.Translation)
+			if dryRun {
+				continue
+			}
+			cur.Translation, cur.Note = t.Translation, t.Note
+			err = retryWithBackoff(ctx, func() error {
+				return h.UpdateTerm(ctx, cur.ID, cur)
+			})
+			if err != nil {
+				return fmt.Errorf("UpdateTerm %s: %w", t.Term, err)
+			}
+		}
+	}
+
+	for _, t := range remote {
+		if wanted[t.Term] {
+			continue
+		}
+		if !glossaryPrune {
+			zap.S().Debugw("keep term missing from the glossary file", "term", t.Term)
+			continue
+		}
+		deleted++
+		zap.S().Infow("delete term", "term", t.Term, "translation", t.Translation)
+		if dryRun {
+			continue
+		}
+		err = retryWithBackoff(ctx, func() error {
+			return h.DeleteTerm(ctx, t.ID)
+		})
+		if err != nil {
+			return fmt.Errorf("DeleteTerm %s: %w", t.Term, err)
+		}
+	}
+
+	zap.S().Infow("glossary synced", "terms", len(local), "created", created, "updated", updated, "deleted", deleted, "dryRun", dryRun)
+	return nil
+}
+
+// termMiss is a translation whose original contains a glossary term but
+// which does not use its agreed translation.
+type termMiss struct {
+	File        string `json:"file"`
+	Key         string `json:"key"`
+	Term        string `json:"term"`
+	Expected    string `json:"expected"`
+	Original    string `json:"original"`
+	Translation string `json:"translation"`
+}
+
+// checkGlossary reports every translated string of the project missing the
+// agreed translation of a term its original contains. Matching ignores case.
+// The misses are written to dump/glossary_report.json.
+func checkGlossary(ctx context.Context) error {
+	terms, err := readGlossary(glossaryFile)
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infoln("Start check glossary", glossaryFile, "against project", paraid)
+
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
+	}
+
+	var mu sync.Mutex
+	misses := []termMiss{}
+
+	jobs := []fileJob{}
+	for _, f := range sortedFiles(m) {
+		jobs = append(jobs, fileJob{name: f.Name, run: func(ctx context.Context) error {
+			var trans []ParatranzTranslation
+			err := retryWithBackoff(ctx, func() error {
+				t, err := h.GetTranslation(ctx, f.ID)
+				trans = t
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("GetTranslation %s %d: %w", f.Name, f.ID, err)
+			}
+
+			found := termMisses(f.Name, trans, terms)
+			mu.Lock()
+			misses = append(misses, found...)
+			mu.Unlock()
+			return nil
+		}})
+	}
+
+	if err := runJobs(ctx, "glossary check", jobs); err != nil {
+		return err
+	}
+
+	sort.Slice(misses, func(i, j int) bool {
+		if misses[i].File != misses[j].File {
+			return misses[i].File < misses[j].File
+		}
+		return misses[i].Key < misses[j].Key
+	})
+
+	b, err := JSONMarshal(misses)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal glossary report: %w", err)
+	}
+
+	p := cfg.dumpPath("glossary_report.json")
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err := os.WriteFile(p, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write glossary report: %w", err)
+	}
+
+	if len(misses) > 0 {
+		zap.S().Warnw("translations not using the glossary", "count", len(misses), "report", p)
+	} else {
+		zap.S().Infow("every translation uses the glossary", "report", p)
+	}
+	return nil
+}
+
+func termMisses(file string, trans []ParatranzTranslation, terms []ParatranzTerm) []termMiss {
+	misses := []termMiss{}
+	for _, t := range trans {
+		if t.Translation == "" || t.Stage < stageTranslated || isForcedKey(t.Key) {
+			continue
+		}
+
+		original := strings.ToLower(t.Original)
+		translation := strings.ToLower(t.Translation)
+		for _, term := range terms {
+			if !strings.Contains(original, strings.ToLower(term.Term)) {
+				continue
+			}
+			if strings.Contains(translation, strings.ToLower(term.Translation)) {
+				continue
+			}
+			misses = append(misses, termMiss{File: file, Key: t.Key, Term: term.Term, Expected: term.Translation, Original: t.Original, Translation: t.Translation})
+		}
+	}
+	return misses
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestReadGlossary(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    []ParatranzTerm
+		wantErr bool
+	}{
+		{
+			name: "csv",
+			file: "glossary.csv",
+			data: "\ufeffterm,translation,note\n# comment\n\n림버스, 边狱 ,\"game, title\"\n단테,但丁\n",
+			want: []ParatranzTerm{{Term: "림버스", Translation: "边狱", Note: "game, title"}, {Term: "단테", Translation: "但丁"}},
+		},
+		{
+			name: "tsv",
+			file: "glossary.tsv",
+			data: "단테\t但\"丁\tnote, with comma\n",
+			want: []ParatranzTerm{{Term: "단테", Translation: "但\"丁", Note: "note, with comma"}},
+		},
+		{
+			name:    "missing translation",
+			file:    "missing.csv",
+			data:    "단테\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate term",
+			file:    "duplicate.csv",
+			data:    "단테,但丁\n단테,丹特\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(p, []byte(tt.data), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readGlossary(p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readGlossary error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("readGlossary = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Term != tt.want[i].Term || got[i].Translation != tt.want[i].Translation || got[i].Note != tt.want[i].Note {
+					t.Errorf("term %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTermMisses(t *testing.T) {
+	terms := []ParatranzTerm{{Term: "Dante", Translation: "但丁"}}
+	trans := []ParatranzTranslation{
+		{Key: "a", Original: "DANTE is here", Translation: "但丁在这", Stage: stageTranslated},
+		{Key: "b", Original: "dante left", Translation: "他走了", Stage: stageReviewed},
+		{Key: "c", Original: "Dante", Translation: "", Stage: stageUntranslated},
+		{Key: "d", Original: "Nobody", Translation: "没人", Stage: stageTranslated},
+	}
+
+	misses := termMisses("A.json", trans, terms)
+	if len(misses) != 1 || misses[0].Key != "b" || misses[0].Expected != "但丁" {
+		t.Errorf("termMisses = %+v, want only b", misses)
+	}
+}
+
+func TestSyncGlossary(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() { glossaryPrune, dryRun = false, false }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+
+	// more terms than one page
+	for i := 0; i < 60; i++ {
+		srv.AddTerm(1, paratranztest.Term{Term: "term" + strconv.Itoa(i), Translation: "t" + strconv.Itoa(i)})
+	}
+	srv.AddTerm(1, paratranztest.Term{Term: "단테", Translation: "丹特"})
+
+	glossaryFile = "glossary.csv"
+	if err := os.WriteFile(glossaryFile, []byte("term59,t59\n단테,但丁\n림버스,边狱\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	dryRun = true
+	if err := syncGlossary(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Terms(1)); n != 61 {
+		t.Fatalf("dry run left %d terms, want 61", n)
+	}
+
+	dryRun = false
+	if err := syncGlossary(ctx); err != nil {
+		t.Fatal(err)
+	}
+	terms := map[string]string{}
+	for _, term := range srv.Terms(1) {
+		terms[term.Term] = term.Translation
+	}
+	if len(terms) != 62 || terms["단테"] != "但丁" || terms["림버스"] != "边狱" {
+		t.Fatalf("terms %v, want 단테 updated, 림버스 created and the others kept", terms)
+	}
+
+	glossaryPrune = true
+	if err := syncGlossary(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Terms(1)); n != 3 {
+		t.Errorf("%d terms after -prune, want only the 3 of the file", n)
+	}
+}
@@ -2,7 +2,6 @@ module ParatranzUploader
 
 go 1.22.2
 
-require (
-	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-)
+require go.uber.org/zap v1.27.0
+
+require go.uber.org/multierr v1.11.0 // indirect
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// operations of a hotfix rule
+const (
+	hotfixSet            = "set"
+	hotfixDelete         = "delete"
+	hotfixCopyFromSource = "copy-from-source"
+	hotfixRegexReplace   = "regex-replace"
+)
+
+// hotfixRule patches exported files where the game assets are wrong. Files
+// are globs matched against the exported file, any folder above it and its
+// name. Path is a getTranMap style path, * matches every key or index.
+type hotfixRule struct {
+	Name    string             `json:"name,omitempty"`
+	Files   []string           `json:"files"`
+	Path    string             `json:"path"`
+	Op      string             `json:"op"`
+	Value   any                `json:"value,omitempty"`
+	Pattern string             `json:"pattern,omitempty"`
+	Replace string             `json:"replace,omitempty"`
+	When    []*hotfixCondition `json:"when,omitempty"`
+
+	index int
+	re    *regexp.Regexp
+}
+
+// hotfixCondition is checked against the value at Path, the path of the
+// rule when empty, before the rule applies. Every field given of every
+// condition of a rule must hold, so a rule stops applying once the asset is
+// fixed upstream or its entries move.
+type hotfixCondition struct {
+	Path      string `json:"path,omitempty"`
+	Exists    *bool  `json:"exists,omitempty"`
+	Equals    any    `json:"equals,omitempty"`
+	NotEquals any    `json:"notEquals,omitempty"`
+	Matches   string `json:"matches,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (r *hotfixRule) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return "rule " + strconv.Itoa(r.index)
+}
+
+var loadedHotfix = struct {
+	once  sync.Once
+	rules []*hotfixRule
+	err   error
+}{}
+
+// hotfixRules reads cfg.HotfixFile once for all files of a run. A missing
+// file means no rules.
+func hotfixRules() ([]*hotfixRule, error) {
+	loadedHotfix.once.Do(func() {
+		loadedHotfix.rules, loadedHotfix.err = readHotfixRules(cfg.HotfixFile)
+	})
+	return loadedHotfix.rules, loadedHotfix.err
+}
+
+func readHotfixRules(p string) ([]*hotfixRule, error) {
+	if p == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		zap.S().Infow("no hotfix rules", "path", p)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []*hotfixRule{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("read hotfix rules %s: %w", p, err)
+	}
+	for i, r := range rules {
+		r.index = i + 1
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("hotfix rules %s: %s: %w", p, r.label(), err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *hotfixRule) compile() error {
+	if len(r.Files) == 0 {
+		return errors.New("files is required")
+	}
+	for _, g := range r.Files {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("glob %q: %w", g, err)
+		}
+	}
+	if keys := strings.Split(r.Path, "->"); len(keys) < 2 || keys[0] != "dataList" {
+		return fmt.Errorf("path %q is not below dataList", r.Path)
+	}
+
+	switch r.Op {
+	case hotfixSet:
+		if r.Value == nil {
+			return errors.New("set needs a value")
+		}
+	case hotfixDelete, hotfixCopyFromSource:
+	case hotfixRegexReplace:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return err
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("unknown op %q, want %s, %s, %s or %s", r.Op, hotfixSet, hotfixDelete, hotfixCopyFromSource, hotfixRegexReplace)
+	}
+
+	for _, c := range r.When {
+		if c.Matches == "" {
+			continue
+		}
+		re, err := regexp.Compile(c.Matches)
+		if err != nil {
+			return err
+		}
+		c.re = re
+	}
+	return nil
+}
+
+func (r *hotfixRule) matchFile(name string) bool {
+	if slices.ContainsFunc(r.Files, func(g string) bool {
+		ok, _ := path.Match(g, path.Base(name))
+		return ok
+	}) {
+		return true
+	}
+	return matchPathGlobs(r.Files, name)
+}
+
+// holds reports whether every condition of the rule is met at p.
+func (r *hotfixRule) holds(pm *PMData, p string) bool {
+	for _, c := range r.When {
+		if !c.holds(pm, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// holds reports whether the condition is met at p.
+func (c *hotfixCondition) holds(pm *PMData, p string) bool {
+	if c.Path != "" {
+		p = c.Path
+	}
+	v, has := pm.get(p)
+
+	if c.Exists != nil && *c.Exists != has {
+		return false
+	}
+	if c.Equals != nil && (!has || !sameJSON(v, c.Equals)) {
+		return false
+	}
+	if c.NotEquals != nil && has && sameJSON(v, c.NotEquals) {
+		return false
+	}
+	if c.re != nil {
+		s, ok := v.(string)
+		if !ok || !c.re.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameJSON compares values by their encoding, so 35 read as a float equals
+// 35 from the rules.
+func sameJSON(a, b any) bool {
+	ab, aerr := encodeJSONValue(a)
+	bb, berr := encodeJSONValue(b)
+	return aerr == nil && berr == nil && bytes.Equal(ab, bb)
+}
+
+// expandPath lists the paths of pm matching a path with * keys. Paths
+// without one are returned as they are.
+func expandPath(pm *PMData, p string) []string {
+	if !strings.Contains(p, "*") {
+		return []string{p}
+	}
+
+	paths := []string{}
+	var walk func(node any, done []string, rest []string)
+	walk = func(node any, done []string, rest []string) {
+		if len(rest) == 0 {
+			paths = append(paths, strings.Join(done, "->"))
+			return
+		}
+		if rest[0] != "*" {
+			if sub, has := getDecoded(node, rest[:1]); has {
+				walk(sub, append(slices.Clone(done), rest[0]), rest[1:])
+			}
+			return
+		}
+		switch vt := node.(type) {
+		case map[string]any:
+			names := []string{}
+			for k := range vt {
+				names = append(names, k)
+			}
+			slices.Sort(names)
+			for _, k := range names {
+				walk(vt[k], append(slices.Clone(done), k), rest[1:])
+			}
+		case []any:
+			for i := range vt {
+				walk(vt[i], append(slices.Clone(done), strconv.Itoa(i)), rest[1:])
+			}
+		}
+	}
+
+	list := make([]any, len(pm.DataList))
+	for i, m := range pm.DataList {
+		list[i] = m
+	}
+	keys := strings.Split(p, "->")
+	walk(list, keys[:1], keys[1:])
+	return paths
+}
+
+// hotfix applies every rule matching the exported file folder/name to pm,
+// in file order. Deletes are applied last, every path refers to the asset
+// as read. Each rule that changes the file is logged to log.
+func hotfix(log *zap.SugaredLogger, pm *PMData, folder, name string) {
+	rules, err := hotfixRules()
+	if err != nil {
+		log.Warnln("hotfix", err)
+		return
+	}
+
+	file := path.Join(folder, name)
+	var source *PMData
+	for _, r := range rules {
+		if !r.matchFile(file) {
+			continue
+		}
+
+		for _, p := range expandPath(pm, r.Path) {
+			if !r.holds(pm, p) {
+				log.Debugw("hotfix condition not met", "rule", r.label(), "file", file, "path", p)
+				continue
+			}
+
+			var err error
+			switch r.Op {
+			case hotfixSet:
+				if sameJSON(valueAt(pm, p), r.Value) {
+					continue
+				}
+				err = pm.set(p, r.Value)
+			case hotfixDelete:
+				err = pm.remove(p)
+			case hotfixCopyFromSource:
+				if source == nil {
+					source, err = readHotfixSource(folder, name)
+					if err != nil {
+						break
+					}
+				}
+				v, has := source.get(p)
+				if !has {
+					err = fmt.Errorf("no value at %s in the source", p)
+					break
+				}
+				if sameJSON(valueAt(pm, p), v) {
+					continue
+				}
+				err = pm.set(p, v)
+			case hotfixRegexReplace:
+				s, ok := valueAt(pm, p).(string)
+				if !ok {
+					err = fmt.Errorf("no string at %s", p)
+					break
+				}
+				after := r.re.ReplaceAllString(s, r.Replace)
+				if after == s {
+					continue
+				}
+				err = pm.set(p, after)
+			}
+			if err != nil {
+				log.Warnw("hotfix failed", "rule", r.label(), "file", file, "path", p, "error", err)
+				continue
+			}
+			log.Infow("hotfix applied", "rule", r.label(), "file", file, "path", p, "op", r.Op)
+		}
+	}
+	pm.applyDeletes()
+}
+
+// valueAt is the value at p, nil when there is none.
+func valueAt(pm *PMData, p string) any {
+	v, _ := pm.get(p)
+	return v
+}
+
+// readHotfixSource reads the source language asset of an exported file.
+func readHotfixSource(folder, name string) (*PMData, error) {
+	p := cfg.sourcePath(folder, name)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	pm := &PMData{raw: b}
+	if err := json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), pm); err != nil {
+		return nil, fmt.Errorf("read %s: %w", p, err)
+	}
+	return pm, nil
+}
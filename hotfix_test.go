@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// useHotfixRules makes hotfix apply the rules of the given file.
+func useHotfixRules(t *testing.T, p string) {
+	t.Helper()
+
+	rules, err := readHotfixRules(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedHotfix.once, loadedHotfix.rules, loadedHotfix.err = sync.Once{}, rules, nil
+	loadedHotfix.once.Do(func() {})
+	t.Cleanup(func() { loadedHotfix.once, loadedHotfix.rules, loadedHotfix.err = sync.Once{}, nil, nil })
+}
+
+func TestReadHotfixRules(t *testing.T) {
+	dir := t.TempDir()
+
+	if rules, err := readHotfixRules(filepath.Join(dir, "missing.json")); err != nil || rules != nil {
+		t.Errorf("missing file = %v, %v, want no rules", rules, err)
+	}
+
+	for name, data := range map[string]string{
+		"no files":    `[{"path": "dataList->0->id", "op": "delete"}]`,
+		"bad path":    `[{"files": ["*"], "path": "id", "op": "delete"}]`,
+		"unknown op":  `[{"files": ["*"], "path": "dataList->0->id", "op": "move"}]`,
+		"no value":    `[{"files": ["*"], "path": "dataList->0->id", "op": "set"}]`,
+		"bad pattern": `[{"files": ["*"], "path": "dataList->0->id", "op": "regex-replace", "pattern": "("}]`,
+		"bad when":    `[{"files": ["*"], "path": "dataList->0->id", "op": "delete", "when": [{"matches": "("}]}]`,
+		"bad glob":    `[{"files": ["["], "path": "dataList->0->id", "op": "delete"}]`,
+		"bad field":   `[{"files": ["*"], "path": "dataList->0->id", "op": "delete", "value2": 1}]`,
+	} {
+		p := filepath.Join(dir, "hotfix.json")
+		os.WriteFile(p, []byte(data), os.ModePerm)
+		if _, err := readHotfixRules(p); err == nil {
+			t.Errorf("%s read, want an error", name)
+		}
+	}
+}
+
+func TestHotfix(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	cfg = defaultConfig()
+	writeAsset(t, "Assets", "kr", "Test.json", "하나 10", "둘 20")
+	const asset = `{"dataList": [{"id": 1, "model": "bad", "content": "一 10"}, {"id": 2, "model": "m2", "content": "二 20"}]}`
+
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{
+			name:  "set",
+			rules: `[{"files": ["StoryData"], "path": "dataList->1->id", "op": "set", "value": "2b"}]`,
+			want:  `{"dataList": [{"id": 1, "model": "bad", "content": "一 10"}, {"id": "2b", "model": "m2", "content": "二 20"}]}`,
+		},
+		{
+			name:  "set when met",
+			rules: `[{"files": ["Test.json"], "path": "dataList->1->id", "op": "set", "value": 3, "when": [{"equals": 2}, {"path": "dataList->0->id", "exists": true}]}]`,
+			want:  `{"dataList": [{"id": 1, "model": "bad", "content": "一 10"}, {"id": 3, "model": "m2", "content": "二 20"}]}`,
+		},
+		{
+			name:  "set when not met",
+			rules: `[{"files": ["Test.json"], "path": "dataList->1->id", "op": "set", "value": 3, "when": [{"equals": 2}, {"path": "dataList->0->id", "notEquals": 1}]}]`,
+			want:  asset,
+		},
+		{
+			name:  "other file",
+			rules: `[{"files": ["UI/*"], "path": "dataList->1->id", "op": "set", "value": 3}]`,
+			want:  asset,
+		},
+		{
+			name:  "delete",
+			rules: `[{"files": ["*"], "path": "dataList->*->model", "op": "delete", "when": [{"matches": "^bad$"}]}]`,
+			want:  `{"dataList": [{"id": 1, "content": "一 10"}, {"id": 2, "model": "m2", "content": "二 20"}]}`,
+		},
+		{
+			name:  "copy from source",
+			rules: `[{"files": ["*"], "path": "dataList->*->model", "op": "copy-from-source"}]`,
+			want:  `{"dataList": [{"id": 1, "model": "m1", "content": "一 10"}, {"id": 2, "model": "m2", "content": "二 20"}]}`,
+		},
+		{
+			name:  "regex replace",
+			rules: `[{"files": ["*"], "path": "dataList->*->content", "op": "regex-replace", "pattern": "(\\d+)$", "replace": "<$1>"}]`,
+			want:  `{"dataList": [{"id": 1, "model": "bad", "content": "一 <10>"}, {"id": 2, "model": "m2", "content": "二 <20>"}]}`,
+		},
+		{
+			name:  "paths refer to the asset as read",
+			rules: `[{"files": ["*"], "path": "dataList->0", "op": "delete"}, {"files": ["*"], "path": "dataList->1->id", "op": "set", "value": 3}]`,
+			want:  `{"dataList": [{"id": 3, "model": "m2", "content": "二 20"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, "hotfix.json")
+			os.WriteFile(p, []byte(tt.rules), os.ModePerm)
+			useHotfixRules(t, p)
+
+			pm := parsePMData(t, asset)
+			hotfix(zap.NewNop().Sugar(), pm, "StoryData", "Test.json")
+			got, err := pm.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("hotfix =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHotfixBattleHint checks the shipped rule only fixes the duplicated id
+// at its place.
+func TestHotfixBattleHint(t *testing.T) {
+	useHotfixRules(t, "hotfix.json")
+
+	battleHint := func(ids map[int]string) string {
+		entries := []string{}
+		for i := 0; i < 36; i++ {
+			id, has := ids[i]
+			if !has {
+				id = strconv.Itoa(i + 1)
+			}
+			entries = append(entries, `{"id": `+id+`, "content": "hint"}`)
+		}
+		return `{"dataList": [` + strings.Join(entries, ", ") + `]}`
+	}
+
+	tests := []struct {
+		name string
+		ids  map[int]string
+		want map[int]string
+	}{
+		{"duplicate", map[int]string{33: `"34"`, 34: `"34"`}, map[int]string{33: `"34"`, 34: `"35"`}},
+		{"fixed upstream as a number", map[int]string{34: "35"}, map[int]string{34: "35"}},
+		{"fixed upstream as a string", map[int]string{33: `"34"`, 34: `"35"`}, map[int]string{33: `"34"`, 34: `"35"`}},
+		{"entries shifted", map[int]string{32: `"34"`, 33: `"34"`}, map[int]string{32: `"34"`, 33: `"34"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := parsePMData(t, battleHint(tt.ids))
+			hotfix(zap.NewNop().Sugar(), pm, "", "BattleHint.json")
+			got, err := pm.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := battleHint(tt.want); string(got) != want {
+				t.Errorf("hotfix =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
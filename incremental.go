@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var incrementalSync = false
+
+const stepStrings = "strings"
+
+// stringDiff classifies the strings of a paratranz file against the
+// originals of the KR asset, keyed like getTranMap.
+type stringDiff struct {
+	added     []string
+	removed   []ParatranzTranslation
+	changed   []ParatranzTranslation
+	unchanged []ParatranzTranslation
+}
+
+// diffStrings compares current paratranz strings with next. Strings without
+// an original are never uploaded by paratranz and are left out of next.
+func diffStrings(current []ParatranzTranslation, next map[string]string) stringDiff {
+	d := stringDiff{}
+
+	seen := map[string]bool{}
+	for _, t := range current {
+		seen[t.Key] = true
+		original, has := next[t.Key]
+		switch {
+		case !has || original == "":
+			d.removed = append(d.removed, t)
+		case original != t.Original:
+			d.changed = append(d.changed, t)
+		default:
+			d.unchanged = append(d.unchanged, t)
+		}
+	}
+
+	for key, original := range next {
+		if !seen[key] && original != "" {
+			d.added = append(d.added, key)
+		}
+	}
+	sort.Strings(d.added)
+
+	return d
+}
+
+// updateIncremental pushes only the strings that differ between paratranz
+// and the KR asset. Strings whose original changed keep their translation
+// but are marked disputed with the old original in the context, so a
+// reviewer decides whether the translation still fits. Index keys move
+// when an entry is inserted or removed, so under them the translations
+// follow their originals first, as after a full update.
+func updateIncremental(ctx context.Context, h *ParatranzHandler, e *journalEntry, pf ParatranzFile, tranfolder, tranname string) error {
+	logger(ctx).Infoln("update incremental", pf.ID, tranfolder, tranname)
+
+	krPath := cfg.sourcePath(tranfolder, tranname)
+
+	_, krPMData, err := getPMData(krPath)
+	if err != nil {
+		return err
+	}
+
+	if len(krPMData.DataList) == 0 {
+		logger(ctx).Errorln("skip empty file", krPath)
+		return nil
+	}
+
+	next := krPMData.getTranMap()
+	contexts := wantedContexts(next, tranfolder, tranname)
+	shifting := cfg.KeyStrategy == keyByIndex
+
+	var oldtrans []ParatranzTranslation
+	if shifting {
+		oldtrans, err = e.originals(ctx, func() ([]ParatranzTranslation, error) {
+			var oldtrans []ParatranzTranslation
+			err := retryWithBackoff(ctx, func() error {
+				trans, err := h.GetTranslation(ctx, pf.ID)
+				oldtrans = trans
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+			}
+			return oldtrans, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the diff is taken from the current paratranz state every time, so a
+	// run that stopped halfway simply pushes what is still missing
+	err = e.run(ctx, stepStrings, func() error {
+		return pushStringDiff(ctx, h, pf, next, contexts, shifting)
+	})
+	if err != nil {
+		return err
+	}
+
+	if shifting {
+		err = e.run(ctx, stepShift, func() error { return fixIncrementalShift(ctx, h, pf, oldtrans, contexts) })
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.run(ctx, stepForces, func() error { return fixByForces(ctx, h, pf, tranfolder, tranname) })
+}
+
+// pushStringDiff writes the diff of the file against next. With shifting
+// the strings whose original changed are left untranslated for
+// fixIncrementalShift instead of disputed.
+func pushStringDiff(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, next, contexts map[string]string, shifting bool) error {
+	var current []ParatranzTranslation
+
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, pf.ID)
+		current = trans
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	d := diffStrings(current, next)
+
+	for _, t := range d.removed {
+		err := retryWithBackoff(ctx, func() error {
+			return h.DeleteString(ctx, pf.ID, t.ID)
+		})
+		if err != nil {
+			return fmt.Errorf("DeleteString %s %s: %w", pf.Name, t.Key, err)
+		}
+	}
+
+	for _, key := range d.added {
+		str := ParatranzString{Key: key, File: &pf.ID, Original: ptr(next[key]), Context: ptr(contexts[key])}
+		err := retryWithBackoff(ctx, func() error {
+			_, err := h.CreateString(ctx, str)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("CreateString %s %s: %w", pf.Name, key, err)
+		}
+	}
+
+	for _, t := range d.changed {
+		str := ParatranzString{Key: t.Key, Original: ptr(next[t.Key]), Context: ptr(changedContext(t.Original, contexts[t.Key]))}
+		switch {
+		case shifting:
+			str.Translation, str.Stage, str.Context = ptr(""), ptr(0), ptr(contexts[t.Key])
+		case t.Translation != "" && t.Stage >= stageTranslated:
+			str.Stage = ptr(stageDisputed)
+		}
+		err := retryWithBackoff(ctx, func() error {
+			return h.UpdateString(ctx, pf.ID, t.ID, str)
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateString %s %s: %w", pf.Name, t.Key, err)
+		}
+	}
+
+	contextOnly := 0
+	for _, t := range d.unchanged {
+		if t.Context == contexts[t.Key] {
+			continue
+		}
+		contextOnly++
+		str := ParatranzString{Key: t.Key, Context: ptr(contexts[t.Key])}
+		err := retryWithBackoff(ctx, func() error {
+			return h.UpdateString(ctx, pf.ID, t.ID, str)
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateString %s %s: %w", pf.Name, t.Key, err)
+		}
+	}
+
+	logger(ctx).Infow("strings pushed", "file", pf.Name, "added", len(d.added), "removed", len(d.removed), "changed", len(d.changed), "context", contextOnly, "unchanged", len(d.unchanged)-contextOnly)
+	return nil
+}
+
+// fixIncrementalShift gives the translations from before the diff back to
+// the strings their originals moved to, as fixFileShift does after a full
+// update. A string whose own translation nothing else took gets it back
+// disputed, like a changed string under id keys.
+func fixIncrementalShift(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, oldtrans []ParatranzTranslation, contexts map[string]string) error {
+	logger(ctx).Infoln("fixIncrementalShift", pf.ID, pf.Name)
+
+	report, err := recoverShift(ctx, h, pf, oldtrans)
+	if err != nil {
+		return err
+	}
+
+	var current []ParatranzTranslation
+	err = retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, pf.ID)
+		current = trans
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+	byKey := map[string]ParatranzTranslation{}
+	for _, t := range current {
+		byKey[t.Key] = t
+	}
+
+	lost := []ParatranzTranslation{}
+	for _, o := range report.Lost {
+		t, has := byKey[o.Key]
+		if !has || t.Stage != 0 || t.Translation != "" {
+			lost = append(lost, o)
+			continue
+		}
+
+		str := ParatranzString{Key: t.Key, Translation: ptr(o.Translation), Stage: ptr(o.Stage), Context: ptr(changedContext(o.Original, contexts[t.Key]))}
+		if o.Stage >= stageTranslated {
+			str.Stage = ptr(stageDisputed)
+		}
+		err := retryWithBackoff(ctx, func() error {
+			return h.UpdateString(ctx, pf.ID, t.ID, str)
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateString %s %s: %w", pf.Name, t.Key, err)
+		}
+	}
+	report.Lost = lost
+
+	if report.Exact > 0 || len(report.Fuzzy) > 0 || len(report.Lost) > 0 {
+		addShiftReport(report)
+	}
+	if len(report.Lost) > 0 {
+		logger(ctx).Warnw("translations lost by the update", "file", pf.Name, "count", len(report.Lost))
+	}
+	return nil
+}
+
+// wantedContexts is the context of every string of next as it should be
+// after the update.
+func wantedContexts(next map[string]string, tranfolder, tranname string) map[string]string {
+	wanted := []ParatranzTranslation{}
+	for key, original := range next {
+		wanted = append(wanted, ParatranzTranslation{Key: key, Original: original})
+	}
+	contexts := map[string]string{}
+	for _, t := range withContext(wanted, tranfolder, tranname) {
+		contexts[t.Key] = t.Context
+	}
+	return contexts
+}
+
+// changedContext keeps the previous original on top of the context of a
+// string whose source text changed.
+func changedContext(previous, context string) string {
+	note := strings.ToUpper(cfg.SourceLang) + " changed, previous original:\n" + previous
+	return strings.TrimSuffix(note+"\n\n"+context, "\n\n")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestDiffStrings(t *testing.T) {
+	current := []ParatranzTranslation{
+		{ID: 1, Key: "a", Original: "same"},
+		{ID: 2, Key: "b", Original: "old"},
+		{ID: 3, Key: "c", Original: "gone"},
+		{ID: 4, Key: "d", Original: "emptied"},
+	}
+	next := map[string]string{"a": "same", "b": "new", "d": "", "e": "added", "f": ""}
+
+	d := diffStrings(current, next)
+
+	keys := func(ts []ParatranzTranslation) []string {
+		out := []string{}
+		for _, t := range ts {
+			out = append(out, t.Key)
+		}
+		return out
+	}
+	if !reflect.DeepEqual(d.added, []string{"e"}) {
+		t.Errorf("added %v, want [e]", d.added)
+	}
+	if got := keys(d.removed); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("removed %v, want [c d]", got)
+	}
+	if got := keys(d.changed); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("changed %v, want [b]", got)
+	}
+	if got := keys(d.unchanged); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("unchanged %v, want [a]", got)
+	}
+}
+
+func TestIncrementalSync(t *testing.T) {
+	dir := t.TempDir()
+	assets := filepath.Join(dir, "Assets")
+	dump := filepath.Join(dir, "dump")
+	config := filepath.Join(dir, "paratranz.json")
+	writeConfig(t, config, map[string]any{"assetsRoot": assets, "dumpDir": dump, "contextLangs": []string{"en"}})
+	defer func() { cfg = defaultConfig() }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	id := srv.AddFile(1, "StoryData/Test.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "하나", Translation: "一", Stage: 5, Context: "EN:\nOne"},
+		{Key: "dataList->1->model", Original: "m2", Translation: "m2", Stage: 1, Context: "EN:\nm2"},
+		{Key: "dataList->1->content", Original: "둘", Translation: "二", Stage: 5, Context: "EN:\nTwo"},
+		{Key: "dataList->2->model", Original: "m3", Translation: "m3", Stage: 1, Context: "EN:\nm3"},
+		{Key: "dataList->2->content", Original: "셋", Translation: "三", Stage: 5, Context: "EN:\nThree"},
+	})
+
+	// the second content changes, the third entry goes away and the missing
+	// first model is added
+	writeAsset(t, assets, "kr", "Test.json", "하나", "둘둘")
+	writeAsset(t, assets, "en", "Test.json", "One", "Two two")
+	os.MkdirAll(dump, os.ModePerm)
+	if err := os.WriteFile(filepath.Join(dump, "kr_files.txt"), []byte("M\tkr/StoryData/KR_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { incrementalSync = false }()
+	runCommand(t, srv, config, "sync", "-from-lists", "-incremental")
+
+	for _, r := range srv.Requests() {
+		if r == "POST /api/projects/1/files/"+strconv.Itoa(id) {
+			t.Errorf("incremental sync re-uploaded the whole file")
+		}
+	}
+
+	strs := stringsByKey(srv.Strings(1, id))
+	if got := strs["dataList->0->content"]; got.Translation != "一" || got.Stage != 5 {
+		t.Errorf("unchanged string %+v, want it untouched", got)
+	}
+	if got := strs["dataList->1->content"]; got.Original != "둘둘" || got.Translation != "二" || got.Stage != stageDisputed || !strings.Contains(got.Context, "둘") {
+		t.Errorf("changed string %+v, want the new original, disputed, with the previous one in the context", got)
+	}
+	if _, has := strs["dataList->2->content"]; has {
+		t.Errorf("removed entry still on paratranz")
+	}
+	if got, has := strs["dataList->0->model"]; !has || got.Original != "m1" {
+		t.Errorf("added string %+v, want it created", got)
+	}
+}
+
+func TestIncrementalSyncShift(t *testing.T) {
+	dir := t.TempDir()
+	assets := filepath.Join(dir, "Assets")
+	dump := filepath.Join(dir, "dump")
+	config := filepath.Join(dir, "paratranz.json")
+	writeConfig(t, config, map[string]any{"assetsRoot": assets, "dumpDir": dump, "contextLangs": []string{"en"}})
+	defer func() { cfg = defaultConfig() }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	id := srv.AddFile(1, "StoryData/Test.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "하나", Translation: "一", Stage: 5},
+		{Key: "dataList->1->content", Original: "둘", Translation: "二", Stage: 5},
+		{Key: "dataList->2->content", Original: "셋", Translation: "三", Stage: 1},
+	})
+
+	// an entry inserted in front of the second moves every later index key
+	writeAsset(t, assets, "kr", "Test.json", "하나", "새", "둘", "셋")
+	writeAsset(t, assets, "en", "Test.json", "One", "New", "Two", "Three")
+	os.MkdirAll(dump, os.ModePerm)
+	if err := os.WriteFile(filepath.Join(dump, "kr_files.txt"), []byte("M\tkr/StoryData/KR_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { incrementalSync = false }()
+	runCommand(t, srv, config, "sync", "-from-lists", "-incremental")
+
+	strs := stringsByKey(srv.Strings(1, id))
+	if got := strs["dataList->1->content"]; got.Original != "새" || got.Translation != "" || got.Stage != 0 {
+		t.Errorf("inserted string %+v, want it untranslated", got)
+	}
+	if got := strs["dataList->2->content"]; got.Original != "둘" || got.Translation != "二" || got.Stage != 5 {
+		t.Errorf("moved string %+v, want the translation and stage it had one key up", got)
+	}
+	if got := strs["dataList->3->content"]; got.Original != "셋" || got.Translation != "三" || got.Stage != 1 {
+		t.Errorf("moved string %+v, want the translation and stage it had one key up", got)
+	}
+}
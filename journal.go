@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// steps of a file recorded in the sync journal
+const (
+	stepOriginals = "originals"
+	stepUploaded  = "uploaded"
+	stepContext   = "context"
+	stepCopied    = "copied"
+	stepForces    = "forces"
+	stepShift     = "shift"
+	stepDeleted   = "deleted"
+)
+
+var resumeSync = false
+
+// syncJournal records every finished step of a sync run in dump/sync_state.json,
+// so a run that died halfway can continue where it stopped instead of redoing
+// files whose translations were already moved.
+type syncJournal struct {
+	mu   sync.Mutex
+	path string
+
+	Head       string          `json:"head,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Files      []*journalEntry `json:"files"`
+}
+
+// journalEntry is one file of the run. The translations from before the
+// upload are kept until the file is done, the shift fix needs them.
+type journalEntry struct {
+	j *syncJournal
+
+	Action          string                 `json:"action"`
+	Name            string                 `json:"name"`
+	Folder          string                 `json:"folder"`
+	File            string                 `json:"file"`
+	ParatranzFile   ParatranzFile          `json:"paratranzFile"`
+	Created         *ParatranzFile         `json:"created,omitempty"`
+	Steps           []string               `json:"steps,omitempty"`
+	Done            bool                   `json:"done,omitempty"`
+	OldTranslations []ParatranzTranslation `json:"oldTranslations,omitempty"`
+}
+
+func journalPath() string {
+	return cfg.dumpPath("sync_state.json")
+}
+
+func newJournal(head string, changes []assetChange) *syncJournal {
+	j := &syncJournal{path: journalPath(), Head: head, StartedAt: time.Now()}
+	for _, c := range changes {
+		j.Files = append(j.Files, &journalEntry{j: j, Action: c.action, Name: c.name, Folder: c.folder, File: c.file, ParatranzFile: c.pf})
+	}
+	return j
+}
+
+// loadJournal returns the journal of an unfinished run, or nil when the last
+// run finished or there was none.
+func loadJournal() (*syncJournal, error) {
+	p := journalPath()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	j := &syncJournal{path: p}
+	if err := json.Unmarshal(b, j); err != nil {
+		return nil, fmt.Errorf("read sync state %s: %w", p, err)
+	}
+	if j.FinishedAt != nil {
+		return nil, nil
+	}
+
+	for _, e := range j.Files {
+		e.j = j
+	}
+	return j, nil
+}
+
+// changes splits the recorded files back into file and context changes.
+func (j *syncJournal) changes() ([]assetChange, []assetChange) {
+	changes, contextChanges := []assetChange{}, []assetChange{}
+	for _, e := range j.Files {
+		c := assetChange{action: e.Action, name: e.Name, folder: e.Folder, file: e.File, pf: e.ParatranzFile}
+		if e.Action == actionContext {
+			contextChanges = append(contextChanges, c)
+		} else {
+			changes = append(changes, c)
+		}
+	}
+	return changes, contextChanges
+}
+
+func (j *syncJournal) entry(name string) *journalEntry {
+	if j == nil {
+		return nil
+	}
+	for _, e := range j.Files {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (j *syncJournal) finish() error {
+	j.mu.Lock()
+	now := time.Now()
+	j.FinishedAt = &now
+	j.mu.Unlock()
+	return j.save()
+}
+
+// save writes the journal through a temporary file, a crash never leaves a
+// half written one behind.
+func (j *syncJournal) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	b, err := JSONMarshal(j)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal sync state: %w", err)
+	}
+
+	os.MkdirAll(filepath.Dir(j.path), os.ModePerm)
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write sync state: %w", err)
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// The methods below work on a nil entry too, steps then always run and
+// nothing is recorded.
+
+func (e *journalEntry) done(step string) bool {
+	if e == nil {
+		return false
+	}
+	e.j.mu.Lock()
+	defer e.j.mu.Unlock()
+	return slices.Contains(e.Steps, step)
+}
+
+func (e *journalEntry) mark(step string, update func()) error {
+	if e == nil {
+		return nil
+	}
+	e.j.mu.Lock()
+	if update != nil {
+		update()
+	}
+	e.Steps = append(e.Steps, step)
+	e.j.mu.Unlock()
+	return e.j.save()
+}
+
+// run does step unless a previous run finished it.
+func (e *journalEntry) run(ctx context.Context, step string, fn func() error) error {
+	if e.done(step) {
+		logger(ctx).Infoln("skip", step, "done in a previous run", e.Name)
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return e.mark(step, nil)
+}
+
+// originals returns the translations from before the upload, fetching and
+// recording them the first time.
+func (e *journalEntry) originals(ctx context.Context, fetch func() ([]ParatranzTranslation, error)) ([]ParatranzTranslation, error) {
+	if e.done(stepOriginals) {
+		logger(ctx).Infoln("use translations recorded in a previous run", e.Name)
+		return e.OldTranslations, nil
+	}
+
+	trans, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	return trans, e.mark(stepOriginals, func() { e.OldTranslations = trans })
+}
+
+// uploaded returns the file created by upload, uploading it the first time.
+func (e *journalEntry) uploaded(ctx context.Context, upload func() (*ParatranzFile, error)) (*ParatranzFile, error) {
+	if e.done(stepUploaded) {
+		logger(ctx).Infoln("skip upload done in a previous run", e.Name)
+		return e.Created, nil
+	}
+
+	pf, err := upload()
+	if err != nil {
+		return nil, err
+	}
+	return pf, e.mark(stepUploaded, func() { e.Created = pf })
+}
+
+// finish marks the whole file done and drops the recorded translations.
+func (e *journalEntry) finish() error {
+	if e == nil {
+		return nil
+	}
+	e.j.mu.Lock()
+	e.Done = true
+	e.OldTranslations = nil
+	e.j.mu.Unlock()
+	return e.j.save()
+}
+
+func (e *journalEntry) isDone() bool {
+	if e == nil {
+		return false
+	}
+	e.j.mu.Lock()
+	defer e.j.mu.Unlock()
+	return e.Done
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+// TestResumeSync stops a sync after the upload, before the shifted
+// translations were put back, and finishes it with -resume.
+func TestResumeSync(t *testing.T) {
+	defer func() { currentRun = nil }()
+	dir := t.TempDir()
+	assets := filepath.Join(dir, "Assets")
+	dump := filepath.Join(dir, "dump")
+	config := filepath.Join(dir, "paratranz.json")
+	writeConfig(t, config, map[string]string{"assetsRoot": assets, "dumpDir": dump})
+	defer func() { cfg = defaultConfig() }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	id := srv.AddFile(1, "StoryData/Test.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "안녕", Translation: "你好", Stage: 5},
+	})
+
+	writeAsset(t, assets, "kr", "Test.json", "새로운", "안녕")
+	os.MkdirAll(dump, os.ModePerm)
+	if err := os.WriteFile(filepath.Join(dump, "kr_files.txt"), []byte("M\tkr/StoryData/KR_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.InjectFault(paratranztest.Fault{Method: http.MethodPost, Path: "/projects/1/files/" + strconv.Itoa(id) + "/translation", Status: http.StatusBadRequest, Times: 1})
+	args := []string{"sync", "-config", config, "-id", "1", "-token", "test", "-api-root", srv.APIRoot(), "-rate-limit", "0", "-from-lists"}
+	if code := runMain(args); code != exitFailure {
+		t.Fatalf("sync with a failing shift fix exited with %d, want %d", code, exitFailure)
+	}
+	if got := stringsByKey(srv.Strings(1, id))["dataList->1->content"]; got.Translation != "" {
+		t.Fatalf("shifted string %+v before the resume, want the translation still lost", got)
+	}
+
+	if code := runMain(args); code != exitFailure {
+		t.Errorf("sync over an unfinished one exited with %d, want a refusal", code)
+	}
+
+	before := len(srv.Requests())
+	if code := runMain(append(args, "-resume")); code != exitOK {
+		t.Fatalf("sync -resume exited with %d", code)
+	}
+
+	if got := stringsByKey(srv.Strings(1, id))["dataList->1->content"]; got.Original != "안녕" || got.Translation != "你好" {
+		t.Errorf("shifted string %+v after the resume, want the recorded translation back", got)
+	}
+	for _, r := range srv.Requests()[before:] {
+		if r == "POST /api/projects/1/files/"+strconv.Itoa(id) {
+			t.Errorf("resume uploaded the file again")
+		}
+	}
+
+	j, err := loadJournal()
+	if err != nil || j != nil {
+		t.Errorf("journal after the resume = %+v, %v, want it finished", j, err)
+	}
+	if b, _ := os.ReadFile(journalPath()); strings.Contains(string(b), "oldTranslations") {
+		t.Errorf("finished journal still holds the old translations")
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// key strategies of projectConfig.KeyStrategy
+const (
+	keyByIndex = "index"
+	keyByID    = "id"
+)
+
+var migrateFrom = keyByIndex
+
+// tranKeys maps the index key of every string, like dataList->3->content,
+// to its key under strategy. With keyByID an array whose elements all carry
+// a distinct id is keyed by it, like dataList->[id=1203]->content, so
+// inserting an entry does not shift the keys of the others.
+func (pm *PMData) tranKeys(strategy string) map[string]string {
+	items := make([]any, len(pm.DataList))
+	for i, item := range pm.DataList {
+		items[i] = item
+	}
+
+	keys := map[string]string{}
+	recursionKeys(items, []string{"dataList"}, []string{"dataList"}, strategy, keys)
+	return keys
+}
+
+func recursionKeys(v any, index, named []string, strategy string, keys map[string]string) {
+	switch vt := v.(type) {
+	case string:
+		keys[strings.Join(index, "->")] = strings.Join(named, "->")
+	case map[string]any:
+		for k, subv := range vt {
+			recursionKeys(subv, append(index, k), append(named, k), strategy, keys)
+		}
+	case []any:
+		segments := elementSegments(vt, strategy)
+		for i, subv := range vt {
+			recursionKeys(subv, append(index, strconv.Itoa(i)), append(named, segments[i]), strategy, keys)
+		}
+	}
+}
+
+// elementSegments keys the elements of an array by id when every element
+// has a distinct one, by index otherwise.
+func elementSegments(items []any, strategy string) []string {
+	segments := make([]string, len(items))
+	for i := range items {
+		segments[i] = strconv.Itoa(i)
+	}
+	if strategy != keyByID {
+		return segments
+	}
+
+	ids := make([]string, len(items))
+	seen := map[string]bool{}
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return segments
+		}
+
+		var id string
+		switch v := m["id"].(type) {
+		case string:
+			id = v
+		case float64:
+			id = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return segments
+		}
+		if id == "" || seen[id] {
+			return segments
+		}
+		seen[id] = true
+		ids[i] = "[id=" + id + "]"
+	}
+	return ids
+}
+
+// rekey turns a map of index keys into the configured key strategy.
+func (pm *PMData) rekey(m map[string]string) map[string]string {
+	if cfg.KeyStrategy != keyByID {
+		return m
+	}
+
+	named := map[string]string{}
+	for index, key := range pm.tranKeys(keyByID) {
+		if v, has := m[index]; has {
+			named[key] = v
+		}
+	}
+	return named
+}
+
+// indexKeys turns a map in the configured key strategy back into index keys.
+func (pm *PMData) indexKeys(m map[string]string) map[string]string {
+	if cfg.KeyStrategy != keyByID {
+		return m
+	}
+
+	index := map[string]string{}
+	for i, key := range pm.tranKeys(keyByID) {
+		if v, has := m[key]; has {
+			index[i] = v
+		}
+	}
+	return index
+}
+
+// uploadData is what gets uploaded to paratranz for the asset. Paratranz
+// keys a raw file by index itself, so other strategies upload its own
+// key/original list in document order.
+func (pm *PMData) uploadData() ([]byte, error) {
+	if cfg.KeyStrategy != keyByID {
+		return pm.raw, nil
+	}
+
+	spans, err := indexJSON(pm.raw)
+	if err != nil {
+		return nil, err
+	}
+
+	index := pm.indexTranMap()
+	keys := pm.tranKeys(keyByID)
+
+	list := []ParatranzTranslation{}
+	for i, original := range index {
+		if original != "" {
+			list = append(list, ParatranzTranslation{Key: i, Original: original})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return spans[list[i].Key].start < spans[list[j].Key].start })
+	for i := range list {
+		list[i].Key = keys[list[i].Key]
+	}
+
+	return JSONMarshal(list)
+}
+
+// migrateKeys re-keys every paratranz file from migrateFrom to the
+// configured strategy. The asset is uploaded again the way sync uploads it
+// and translations and stages are put back under the new keys, a backup of
+// each file is kept in dump/migrate first.
+func migrateKeys(ctx context.Context) error {
+	if migrateFrom == cfg.KeyStrategy {
+		return fmt.Errorf("%w: the config already uses %s keys, set keyStrategy to the target first", errUsage, cfg.KeyStrategy)
+	}
+
+	zap.S().Infoln("Start migrate keys from", migrateFrom, "to", cfg.KeyStrategy)
+
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
+	}
+
+	jobs := []fileJob{}
+	for _, f := range sortedFiles(m) {
+		jobs = append(jobs, fileJob{name: f.Name, run: func(ctx context.Context) error {
+			return migrateFile(ctx, h, f)
+		}})
+	}
+
+	return runJobs(ctx, "migrate keys", jobs)
+}
+
+func migrateFile(ctx context.Context, h *ParatranzHandler, pf ParatranzFile) error {
+	tranfolder, tranname := filepath.Dir(pf.Name), filepath.Base(pf.Name)
+
+	krPath := cfg.sourcePath(tranfolder, tranname)
+	if _, err := os.Stat(krPath); err != nil {
+		logger(ctx).Warnln("skip file without asset", pf.Name, err)
+		return nil
+	}
+	_, krPMData, err := getPMData(krPath)
+	if err != nil {
+		return err
+	}
+
+	// old key to new key
+	rename := map[string]string{}
+	known := map[string]bool{}
+	to := krPMData.tranKeys(cfg.KeyStrategy)
+	for index, key := range krPMData.tranKeys(migrateFrom) {
+		known[key], known[to[index]] = true, true
+		if to[index] != key {
+			rename[key] = to[index]
+		}
+	}
+
+	var trans []ParatranzTranslation
+
+	err = retryWithBackoff(ctx, func() error {
+		t, err := h.GetTranslation(ctx, pf.ID)
+		trans = t
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	renamed, missing := 0, 0
+	restore := []ParatranzTranslation{}
+	for _, t := range trans {
+		if key, has := rename[t.Key]; has {
+			t.Key = key
+			renamed++
+		} else if !known[t.Key] {
+			missing++
+		}
+		if t.Translation != "" || t.Stage != 0 {
+			restore = append(restore, t)
+		}
+	}
+
+	logger(ctx).Infow("migrate keys", "file", pf.Name, "strings", len(trans), "renamed", renamed, "unknown", missing)
+	if renamed == 0 || dryRun {
+		return nil
+	}
+
+	backup := cfg.dumpPath("migrate", pf.Name+".json")
+	b, err := JSONMarshal(trans)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal %s: %w", pf.Name, err)
+	}
+	os.MkdirAll(filepath.Dir(backup), os.ModePerm)
+	if err := os.WriteFile(backup, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write backup %s: %w", backup, err)
+	}
+
+	krRawData, err := krPMData.uploadData()
+	if err != nil {
+		return fmt.Errorf("%s: %w", krPath, err)
+	}
+
+	err = retryWithBackoff(ctx, func() error {
+		return h.UpdateFile(ctx, pf.ID, krRawData, tranfolder, tranname, true)
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateFile %s: %w", pf.Name, err)
+	}
+	if err := updateContext(ctx, h, pf, tranfolder, tranname); err != nil {
+		return err
+	}
+
+	if len(restore) == 0 {
+		return nil
+	}
+
+	tranb, err := JSONMarshal(restore)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal %s: %w", pf.Name, err)
+	}
+
+	err = retryWithBackoff(ctx, func() error {
+		return h.UpdateTranslation(ctx, pf.ID, tranb, pf.Name, true, true)
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateTranslation %s, backup in %s: %w", pf.Name, backup, err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestTranKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		strategy string
+		want     map[string]string
+	}{
+		{
+			name:     "index",
+			raw:      `{"dataList": [{"id": 7, "content": "a"}]}`,
+			strategy: keyByIndex,
+			want:     map[string]string{"dataList->0->content": "dataList->0->content"},
+		},
+		{
+			name:     "id",
+			raw:      `{"dataList": [{"id": 7, "content": "a"}, {"id": "x", "content": "b", "tag": ["c"]}]}`,
+			strategy: keyByID,
+			want: map[string]string{
+				"dataList->0->content": "dataList->[id=7]->content",
+				"dataList->1->id":      "dataList->[id=x]->id",
+				"dataList->1->content": "dataList->[id=x]->content",
+				"dataList->1->tag->0":  "dataList->[id=x]->tag->0",
+			},
+		},
+		{
+			name:     "duplicate ids fall back to the index",
+			raw:      `{"dataList": [{"id": 1, "content": "a"}, {"id": 1, "content": "b"}]}`,
+			strategy: keyByID,
+			want:     map[string]string{"dataList->0->content": "dataList->0->content", "dataList->1->content": "dataList->1->content"},
+		},
+		{
+			name:     "missing id falls back to the index",
+			raw:      `{"dataList": [{"id": 1, "content": "a"}, {"content": "b"}]}`,
+			strategy: keyByID,
+			want:     map[string]string{"dataList->0->content": "dataList->0->content", "dataList->1->content": "dataList->1->content"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parsePMData(t, tt.raw).tranKeys(tt.strategy)
+			if len(got) != len(tt.want) {
+				t.Fatalf("tranKeys = %v, want %v", got, tt.want)
+			}
+			for index, key := range tt.want {
+				if got[index] != key {
+					t.Errorf("key of %s = %q, want %q", index, got[index], key)
+				}
+			}
+		})
+	}
+}
+
+func TestRekeyRoundTrip(t *testing.T) {
+	defer func(c projectConfig) { cfg = c }(cfg)
+	cfg.KeyStrategy = keyByID
+
+	pm := parsePMData(t, `{"dataList": [{"id": 3, "content": "a"}, {"id": 9, "content": "b"}]}`)
+	named := pm.rekey(pm.indexTranMap())
+	if named["dataList->[id=9]->content"] != "b" {
+		t.Fatalf("rekey = %v, want content keyed by id", named)
+	}
+	if back := pm.indexKeys(named); back["dataList->1->content"] != "b" || len(back) != len(named) {
+		t.Errorf("indexKeys = %v, want the index keys back", back)
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	defer func(c projectConfig) { cfg = c }(cfg)
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+	h := newParatranzHandler(paraid)
+	ctx := context.Background()
+
+	writeAsset(t, "Assets", "kr", "Test.json", "안녕", "세계")
+	if err := create(ctx, h, nil, "StoryData", "Test.json"); err != nil {
+		t.Fatal(err)
+	}
+	f := srv.Files(1)["StoryData/Test.json"]
+	tb, _ := json.Marshal([]ParatranzTranslation{{Key: "dataList->1->content", Translation: "世界", Stage: 5}})
+	if err := h.UpdateTranslation(ctx, f.ID, tb, f.Name, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, "paratranz.json", map[string]any{"keyStrategy": keyByID})
+	runCommand(t, srv, "paratranz.json", "migrate-keys", "-dry-run")
+	if _, has := stringsByKey(srv.Strings(1, f.ID))["dataList->1->content"]; !has {
+		t.Fatal("dry run re-keyed the file")
+	}
+
+	runCommand(t, srv, "paratranz.json", "migrate-keys")
+	strs := stringsByKey(srv.Strings(1, f.ID))
+	if got := strs["dataList->[id=2]->content"]; got.Original != "세계" || got.Translation != "世界" || got.Stage != 5 {
+		t.Errorf("migrated string %+v, want the translation and stage under the id key", got)
+	}
+	if _, has := strs["dataList->1->content"]; has {
+		t.Error("index key left after the migration")
+	}
+	if _, err := os.Stat(cfg.dumpPath("migrate", f.Name+".json")); err != nil {
+		t.Errorf("no backup of the migrated file: %v", err)
+	}
+}
+
+// TestIDKeysRoundTrip creates a file under id keys, inserts an entry in
+// front of the translated ones and exports it again.
+func TestIDKeysRoundTrip(t *testing.T) {
+	defer func(c projectConfig) { cfg = c }(cfg)
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+	cfg.KeyStrategy = keyByID
+	h := newParatranzHandler(paraid)
+	ctx := context.Background()
+
+	writeAsset(t, "Assets", "kr", "Test.json", "안녕", "세계")
+	writeAsset(t, "Assets", "en", "Test.json", "Hello", "World")
+	if err := create(ctx, h, nil, "StoryData", "Test.json"); err != nil {
+		t.Fatal(err)
+	}
+	f := srv.Files(1)["StoryData/Test.json"]
+	strs := stringsByKey(srv.Strings(1, f.ID))
+	if got := strs["dataList->[id=2]->content"]; got.Original != "세계" || !strings.Contains(got.Context, "World") {
+		t.Fatalf("created string %+v, want the KR original under its id key with EN context", got)
+	}
+
+	tb, _ := json.Marshal([]ParatranzTranslation{
+		{Key: "dataList->[id=1]->content", Translation: "你好", Stage: 5},
+		{Key: "dataList->[id=2]->content", Translation: "世界", Stage: 5},
+	})
+	if err := h.UpdateTranslation(ctx, f.ID, tb, f.Name, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new entry takes the first position but a fresh id
+	for lang, content := range map[string]string{"kr": "새로운", "en": "New"} {
+		p := filepath.Join("Assets", lang, "StoryData", strings.ToUpper(lang)+"_Test.json")
+		b, _ := os.ReadFile(p)
+		b = bytes.Replace(b, []byte(`{"id": 1,`), []byte(`{"id": 3, "model": "m3", "content": "`+content+`"},`+"\n    "+`{"id": 1,`), 1)
+		if err := os.WriteFile(p, b, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := h.GetFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := update(ctx, h, nil, files[f.Name], "StoryData", "Test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	strs = stringsByKey(srv.Strings(1, f.ID))
+	for key, want := range map[string]string{"dataList->[id=3]->content": "", "dataList->[id=1]->content": "你好", "dataList->[id=2]->content": "世界"} {
+		if got := strs[key]; got.Translation != want {
+			t.Errorf("%s = %q after the update, want %q", key, got.Translation, want)
+		}
+	}
+
+	os.MkdirAll("dump", os.ModePerm)
+	if err := os.WriteFile(filepath.Join("dump", "en_files.txt"), []byte("M\ten/StoryData/EN_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportAssets(ctx, "en"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, pm, err := getPMData(filepath.Join(cfg.exportDir(), "StoryData", "Test.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pm.indexTranMap()
+	for key, want := range map[string]string{"dataList->0->content": "New", "dataList->1->content": "你好", "dataList->2->content": "世界"} {
+		if got[key] != want {
+			t.Errorf("exported %s = %q, want %q", key, got[key], want)
+		}
+	}
+}
@@ -2,248 +2,244 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"html"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-const (
-	exportRoot = "export/LimbusCompany_Data/Lang/TW"
-)
-
 var (
 	token  = ""
 	paraid = 0
 
 	paraid2 = 0
 
-	assetsUpdate        = false
 	assetsContextUpdate = false
 
 	syncid = 0
 
-	exportFromAssets   = ""
+	exportLang         = ""
 	exportWithArtifact = false
 	replacefile        = ""
-	exportUT           = false
 
-	reseteol = false
-)
+	eolList         = ""
+	eolArtifactRoot = ""
 
-func init() {
-	flag.IntVar(&paraid, "id", 0, "paratranz repo id")
-	flag.IntVar(&paraid2, "id2", 0, "paratranz repo id")
-	flag.StringVar(&token, "token", "", "paratranz token")
+	dryRun = false
 
-	flag.BoolVar(&assetsUpdate, "update", false, "update from assets")
-	flag.BoolVar(&assetsContextUpdate, "update-context", false, "update context from assets")
-	flag.IntVar(&syncid, "sync-from", 0, "sync project's translation from this id")
-
-	flag.StringVar(&exportFromAssets, "export", "", "export assets from kr or en or jp")
-	flag.BoolVar(&exportWithArtifact, "from-artifact", false, "export use downloaded artifact")
-	flag.StringVar(&replacefile, "replace", "", "replace translation from file")
-	flag.BoolVar(&reseteol, "reset-eol", false, "reset end of line from files")
-	flag.BoolVar(&exportUT, "export-untranslate", false, "export untranslate storydata")
+	runTimeout     time.Duration
+	requestTimeout time.Duration
+	apiRoot        = ""
+	rateLimit      = 0.0
+)
 
-	flag.Parse()
+func main() {
+	os.Exit(runMain(os.Args[1:]))
 }
 
-func main() {
+func runMain(args []string) int {
+	cmd, fs, code := parseCommand(args)
+	if cmd == nil {
+		return code
+	}
+
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
 	zap.ReplaceGlobals(logger)
 
-	if assetsUpdate {
-		updateFromAssets()
+	if err := applyConfig(fs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
 	}
 
-	// if syncid != 0 {
-	// 	syncTran()
-	// }
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if exportFromAssets != "" {
-		fromLang := strings.ToLower(exportFromAssets)
-		if exportWithArtifact {
-			exportAssetsWithArtifact(fromLang, paraid, paraid2)
-		} else {
-			exportAssets(fromLang)
-		}
+	if runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runTimeout)
+		defer cancel()
 	}
 
-	if replacefile != "" {
-		replaceFromFile(replacefile)
+	if cmd.writes && !dryRun {
+		currentRun = newRunSnapshot(cmd.name, args[1:])
 	}
 
-	if exportUT {
-		exportUntranslateStory()
+	err := cmd.run(ctx, fs)
+	if currentRun != nil {
+		// an interrupted run still takes its after snapshot, within a short
+		// deadline of its own
+		finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runFinishTimeout)
+		currentRun.finish(finishCtx)
+		cancel()
 	}
 
-	// if reseteol {
-	// 	resetEOL()
-	// }
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return exitUsage
+	case errors.Is(err, ErrUnauthorized):
+		zap.S().Errorln("paratranz rejected the token, check -token and the project id:", err)
+	case ctx.Err() != nil:
+		zap.S().Warnln(cmd.name, "stopped before finishing:", err)
+		return exitInterrupted
+	default:
+		zap.S().Errorln(cmd.name, "failed:", err)
+	}
+	return exitFailure
 }
 
-func resetEOL() {
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func newParatranzHandler(id int) *ParatranzHandler {
+	opts := []ParatranzOption{WithAPIRoot(apiRoot), WithRequestTimeout(requestTimeout), WithRateLimit(rateLimit, paratranzRateBurst)}
+	if dryRun {
+		opts = append(opts, WithReadOnly())
+	}
+	if currentRun != nil {
+		opts = append(opts, WithSnapshot(currentRun))
+	}
+	return NewParatranzHandler(id, token, opts...)
+}
+
+// stopped logs how far a file loop got before an error or cancellation ended it.
+func stopped(stage string, done, total int, err error) error {
+	zap.S().Warnw(stage+" stopped", "done", done, "total", total, "error", err)
+	return err
+}
+
+func resetEOL(ctx context.Context) error {
 	zap.S().Infoln("Start reset end of line")
 
-	artifactRoot := "download/raw/"
+	if eolList == "" {
+		eolList = cfg.dumpPath("space_files.txt")
+	}
+	if eolArtifactRoot == "" {
+		eolArtifactRoot = filepath.Join(cfg.DownloadDir, "raw") + "/"
+	}
 
-	b, err := os.ReadFile(filepath.Join("dump/space_files.txt"))
+	b, err := os.ReadFile(eolList)
 	if err != nil {
-		zap.S().Fatalln("read replace file error", replacefile, err)
+		return fmt.Errorf("read eol list %s: %w", eolList, err)
 	}
 
 	list := strings.Split(string(b), "\n")
 
-	h := NewParatranzHandler(paraid, token)
+	h := newParatranzHandler(paraid)
 
-	m, err := h.GetFiles()
+	m, err := h.GetFiles(ctx)
 	if err != nil {
-		zap.S().Fatalln("GetFiles error", paraid, err)
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
 	}
 
-	for _, name := range list {
-		paraname := strings.TrimSuffix(strings.TrimPrefix(name, artifactRoot), ".json")
+	for i, name := range list {
+		paraname := strings.TrimSuffix(strings.TrimPrefix(name, eolArtifactRoot), ".json")
 
 		if para, has := m[paraname]; has {
 			fmt.Println(name, para.ID, para.Folder, para.Name)
 			bfile, err := os.ReadFile(name)
 			if err != nil {
-				zap.S().Fatalln("GetFiles error", paraid, err)
+				return stopped("reset eol", i, len(list), err)
 			}
 
-			err = retryWithBackoff(func() error {
-				return h.UpdateFile(para.ID, bfile, para.Folder, para.Name, true)
+			err = retryWithBackoff(ctx, func() error {
+				return h.UpdateFile(ctx, para.ID, bfile, para.Folder, para.Name, true)
 			})
 
 			if err != nil {
-				zap.S().Fatalln("UpdateFile error", para.Name, err)
+				return stopped("reset eol", i, len(list), fmt.Errorf("UpdateFile %s: %w", para.Name, err))
 			}
 
-			err = retryWithBackoff(func() error {
-				return h.UpdateTranslation(para.ID, bfile, para.Name, true, false)
+			err = retryWithBackoff(ctx, func() error {
+				return h.UpdateTranslation(ctx, para.ID, bfile, para.Name, true, false)
 			})
 
 			if err != nil {
-				zap.S().Fatalln("UpdateTranslation error", para.Name, err)
+				return stopped("reset eol", i, len(list), fmt.Errorf("UpdateTranslation %s: %w", para.Name, err))
 			}
 
 		}
 	}
 
+	return nil
 }
 
-func replaceFromFile(replacefile string) {
-	zap.S().Infoln("Start replace translation from file:", replacefile)
-
-	b, err := os.ReadFile(replacefile)
-	if err != nil {
-		zap.S().Fatalln("read replace file error", replacefile, err)
-	}
-
-	rmap := map[string]string{}
-	list := strings.Split(string(b), "\n")
-	for _, row := range list {
-		before, after, found := strings.Cut(row, "|")
-		if !found {
-			zap.S().Fatalln("replace file parser error", row, err)
-		}
-		rmap[before] = after
-	}
-
-	h := NewParatranzHandler(paraid, token)
-
-	m, err := h.GetFiles()
-	if err != nil {
-		zap.S().Fatalln("GetFiles error", paraid, err)
-	}
-
+// sortedFiles lists files by name so runs over the whole project are repeatable.
+func sortedFiles(m map[string]ParatranzFile) []ParatranzFile {
+	files := make([]ParatranzFile, 0, len(m))
 	for _, f := range m {
-		var paraTrans []ParatranzTranslation
-		err := retryWithBackoff(func() error {
-			trans, err := h.GetTranslation(f.ID)
-			paraTrans = trans
-			return err
-		})
-
-		if err != nil {
-			zap.S().Fatalln("GetTranslation", err)
-		}
-
-		changeset := map[int]bool{}
-		for i, t := range paraTrans {
-			for from, to := range rmap {
-				if strings.Contains(t.Translation, from) {
-					changeset[i] = true
-					paraTrans[i].Translation = strings.ReplaceAll(paraTrans[i].Translation, from, to)
-				}
-			}
-		}
-
-		if len(changeset) > 0 {
-			zap.S().Infoln("change translation", f.Name, len(changeset))
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
 
-			updateTrans := []ParatranzTranslation{}
-			for i := range changeset {
-				updateTrans = append(updateTrans, paraTrans[i])
-			}
+func exportAssetsWithArtifact(ctx context.Context, langType string, id1, id2 int) error {
+	zap.S().Infoln("Start use artifact export translation assets from lang:", langType)
 
-			b, err := JSONMarshal(updateTrans)
-			if err != nil {
-				zap.S().Fatalln("JSONMarshal", err)
+	if artifactMaxAge > 0 || artifactRegenerate {
+		for _, id := range []int{id1, id2} {
+			if id == 0 {
+				continue
 			}
-
-			err = retryWithBackoff(func() error {
-				return h.UpdateTranslation(f.ID, b, f.Name, true, false)
-			})
-
-			if err != nil {
-				zap.S().Fatalln("UpdateTranslation", err)
+			if err := ensureArtifact(ctx, id); err != nil {
+				return err
 			}
 		}
 	}
-}
 
-func exportAssetsWithArtifact(langType string, id1, id2 int) {
-	zap.S().Infoln("Start use artifact export translation assets from lang:", langType)
+	if _, err := hotfixRules(); err != nil {
+		return err
+	}
 
+	exportRoot := cfg.exportDir()
 	os.MkdirAll(exportRoot, os.ModePerm)
 
-	artifact1Root := filepath.Join("download", strconv.Itoa(id1), "raw")
+	artifact1Root := cfg.artifactRaw(id1)
 	artifact2Root := ""
 	if id2 != 0 {
-		artifact2Root = filepath.Join("download", strconv.Itoa(id2), "raw")
+		artifact2Root = cfg.artifactRaw(id2)
 	}
 
 	raws, err := os.ReadDir(artifact1Root)
-
 	if err != nil {
-		zap.S().Fatalln("read fail", artifact1Root, err)
+		return fmt.Errorf("read artifact %s: %w", artifact1Root, err)
 	}
 
-	process := func(folder, name string) {
+	process := func(folder, name string) error {
 		assetsname := strings.TrimSuffix(name, ".json")
 		zap.S().Infoln("Start export", folder, assetsname)
 
 		artifact1filepath := filepath.Join(artifact1Root, folder, name)
-		krfilepath := filepath.Join("Assets", "kr", folder, "KR_"+assetsname)
-		enfilepath := filepath.Join("Assets", langType, folder, strings.ToUpper(langType)+"_"+assetsname)
+		krfilepath := cfg.sourcePath(folder, assetsname)
+		enfilepath := cfg.assetPath(langType, folder, assetsname)
 
 		_, krPMData, krerr := getPMData(krfilepath)
 
 		if krerr != nil {
-			zap.S().Errorw("missing assets file", "path", krfilepath)
-			return
+			zap.S().Errorw("missing assets file", "path", krfilepath, "error", krerr)
+			return nil
 		}
 
 		if folder != "" {
@@ -254,93 +250,75 @@ func exportAssetsWithArtifact(langType string, id1, id2 int) {
 
 		// setup lang
 		if enerr == nil {
-			enm := enPMData.getTranMap()
-			krPMData.setFromTranMap(enm)
+			if err := krPMData.setFromTranMap(enPMData.getTranMap()); err != nil {
+				return fmt.Errorf("export %s: %w", krfilepath, err)
+			}
 		}
 
 		// setup para2
 		if artifact2Root != "" {
 			artifact2filepath := filepath.Join(artifact2Root, folder, name)
-			b, err := os.ReadFile(artifact2filepath)
+			m, err := readArtifactTranMap(artifact2filepath)
 			if err != nil {
 				zap.S().Warnln("export read artifact2 file fail", artifact2filepath, err)
-				goto PARA2_SKIP
+			} else if err := krPMData.setFromTranMap(m); err != nil {
+				return fmt.Errorf("export %s: %w", krfilepath, err)
 			}
-
-			fromTrans := []ParatranzTranslation{}
-
-			err = json.Unmarshal(b, &fromTrans)
-			if err != nil {
-				zap.S().Warnln("export Unmarshal artifact2 fail", artifact2filepath, err)
-				goto PARA2_SKIP
-			}
-
-			m := map[string]string{}
-
-			for _, t := range fromTrans {
-				m[t.Key] = strings.ReplaceAll(html.UnescapeString(t.Translation), "\\n", "\n")
-			}
-
-			krPMData.setFromTranMap(m)
 		}
-	PARA2_SKIP:
 
 		// setup para1
-		{
-			b, err := os.ReadFile(artifact1filepath)
-			if err != nil {
-				zap.S().Fatalln("export read artifact file fail", artifact1filepath, err)
-			}
-
-			fromTrans := []ParatranzTranslation{}
-
-			err = json.Unmarshal(b, &fromTrans)
-			if err != nil {
-				zap.S().Fatalln("export Unmarshal artifact fail", artifact1filepath, err)
-			}
-
-			m := map[string]string{}
-
-			for _, t := range fromTrans {
-				m[t.Key] = strings.ReplaceAll(html.UnescapeString(t.Translation), "\\n", "\n")
-			}
-
-			krPMData.setFromTranMap(m)
+		m, err := readArtifactTranMap(artifact1filepath)
+		if err != nil {
+			return fmt.Errorf("export read artifact file %s: %w", artifact1filepath, err)
+		}
+		if err := krPMData.setFromTranMap(m); err != nil {
+			return fmt.Errorf("export %s: %w", krfilepath, err)
 		}
 
-		hotfix(krPMData, assetsname)
+		hotfix(zap.S(), krPMData, folder, assetsname)
 
-		b, err := JSONMarshal(krPMData)
+		// an edit the raw file cannot take leaves this file out of the
+		// export, validate then reports it missing
+		b, err := krPMData.Bytes()
 		if err != nil {
-			zap.S().Fatalln("JSONMarshal", err)
+			zap.S().Errorw("export skip file", "file", krfilepath, "error", err)
+			return nil
 		}
 
 		err = os.WriteFile(filepath.Join(exportRoot, folder, assetsname), b, os.ModePerm)
 		if err != nil {
-			zap.S().Fatalln("export WriteFile fail", artifact1filepath, err)
+			return fmt.Errorf("export WriteFile %s: %w", artifact1filepath, err)
 		}
+		return nil
 	}
 
-	for _, raw := range raws {
+	for i, raw := range raws {
+		if ctx.Err() != nil {
+			return stopped("export", i, len(raws), ctx.Err())
+		}
 		if raw.IsDir() {
 			folder := raw.Name()
 			subraws, err := os.ReadDir(filepath.Join(artifact1Root, folder))
 			if err != nil {
-				zap.S().Fatalln("read fail", artifact1Root, folder, err)
+				return stopped("export", i, len(raws), fmt.Errorf("read artifact %s: %w", filepath.Join(artifact1Root, folder), err))
 			}
 			for _, subraw := range subraws {
-				process(folder, subraw.Name())
+				if err := process(folder, subraw.Name()); err != nil {
+					return stopped("export", i, len(raws), err)
+				}
 			}
 			continue
 		}
-		process("", raw.Name())
+		if err := process("", raw.Name()); err != nil {
+			return stopped("export", i, len(raws), err)
+		}
 	}
 
-	filelistpath := filepath.Join("dump", langType+"_files.txt")
+	filelistpath := cfg.fileList(langType)
 
 	b, err := os.ReadFile(filelistpath)
 	if err != nil {
-		zap.S().Fatalln("read fail", filelistpath, err)
+		return fmt.Errorf("read file list: %w", err)
 	}
 
 	lines := strings.Split(string(b), "\n")
@@ -351,101 +329,134 @@ func exportAssetsWithArtifact(langType string, id1, id2 int) {
 		}
 		sp := strings.Split(line, "\t")
 		if len(sp) < 2 {
-			zap.S().Fatalln("files.txt split error:", line)
+			return fmt.Errorf("%s: split error: %s", filelistpath, line)
 		}
 
 		tranfolder, tranname := getLangTranPath(sp[1], langType)
 
 		artifactfilepath := filepath.Join(artifact1Root, tranfolder, tranname) + ".json"
 
-		assetsPath := filepath.Join("Assets", langType, tranfolder, strings.ToUpper(langType)+"_"+tranname)
-		assetsRawData, _, _ := getPMData(assetsPath)
+		if _, err := os.Stat(artifactfilepath); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		assetsPath := cfg.assetPath(langType, tranfolder, tranname)
+		assetsRawData, _, err := getPMData(assetsPath)
+		if err != nil {
+			return fmt.Errorf("export from %s: %w", langType, err)
+		}
 
 		os.MkdirAll(filepath.Join(exportRoot, tranfolder), os.ModePerm)
 
-		if _, err := os.Stat(artifactfilepath); errors.Is(err, os.ErrNotExist) {
-			zap.S().Infoln("Start export from", langType, tranfolder, tranname)
-			err := os.WriteFile(filepath.Join(exportRoot, tranfolder, tranname), assetsRawData, os.ModePerm)
-			if err != nil {
-				zap.S().Fatalln("export WriteFile fail", assetsPath, err)
-			}
+		zap.S().Infoln("Start export from", langType, tranfolder, tranname)
+		err = os.WriteFile(filepath.Join(exportRoot, tranfolder, tranname), assetsRawData, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("export WriteFile %s: %w", assetsPath, err)
 		}
-
 	}
+
+	return nil
 }
 
-func hotfix(pm *PMData, filename string) {
-	if filename == "BattleHint.json" {
-		pm.DataList[34]["id"] = "35"
+// readArtifactTranMap reads the translations of an artifact file by key,
+// unescaped like the api returns them.
+func readArtifactTranMap(p string) (map[string]string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	fromTrans := []ParatranzTranslation{}
+	if err := json.Unmarshal(b, &fromTrans); err != nil {
+		return nil, err
+	}
+
+	m := map[string]string{}
+	for _, t := range fromTrans {
+		m[t.Key] = strings.ReplaceAll(html.UnescapeString(t.Translation), "\\n", "\n")
 	}
+	return m, nil
 }
 
-func exportAssets(langType string) {
+func exportAssets(ctx context.Context, langType string) error {
 	zap.S().Infoln("Start export translation assets from lang:", langType)
 
-	os.MkdirAll(exportRoot, os.ModePerm)
+	if _, err := hotfixRules(); err != nil {
+		return err
+	}
+
+	os.MkdirAll(cfg.exportDir(), os.ModePerm)
 
-	h := NewParatranzHandler(paraid, token)
+	h := newParatranzHandler(paraid)
 
-	m, err := h.GetFiles()
+	m, err := h.GetFiles(ctx)
 	if err != nil {
-		zap.S().Fatalln("GetFiles error", paraid, err)
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
 	}
 
-	filelistpath := filepath.Join("dump", langType+"_files.txt")
+	filelistpath := cfg.fileList(langType)
 
 	b, err := os.ReadFile(filelistpath)
 	if err != nil {
-		zap.S().Fatalln("read fail", filelistpath, err)
+		return fmt.Errorf("read file list: %w", err)
 	}
 
 	lines := strings.Split(string(b), "\n")
 
+	jobs := []fileJob{}
 	for _, line := range lines {
 		if len(line) == 0 {
 			continue
 		}
 		sp := strings.Split(line, "\t")
 		if len(sp) < 2 {
-			zap.S().Fatalln("files.txt split error:", line)
+			return fmt.Errorf("%s: split error: %s", filelistpath, line)
 		}
 
 		tranpath, tranname := getLangTranPath(sp[1], langType)
 		fulltranpath := filepath.Join(tranpath, tranname)
+		var paraFile *ParatranzFile
 		if f, has := m[fulltranpath]; has {
-			export(h, langType, tranpath, tranname, &f)
-		} else {
-			export(h, langType, tranpath, tranname, nil)
+			paraFile = &f
 		}
+		jobs = append(jobs, fileJob{name: fulltranpath, run: func(ctx context.Context) error {
+			return export(ctx, h, langType, tranpath, tranname, paraFile)
+		}})
 	}
+
+	return runJobs(ctx, "export", jobs)
 }
 
-func export(h *ParatranzHandler, langType, tranfolder, tranname string, paraFile *ParatranzFile) {
-	zap.S().Infoln("Start export", tranfolder, tranname)
+func export(ctx context.Context, h *ParatranzHandler, langType, tranfolder, tranname string, paraFile *ParatranzFile) error {
+	logger(ctx).Infoln("Start export", tranfolder, tranname)
 
-	assetsPath := filepath.Join("Assets", langType, tranfolder, strings.ToUpper(langType)+"_"+tranname)
-	assetsRawData, assetsPMData, _ := getPMData(assetsPath)
+	exportRoot := cfg.exportDir()
+	assetsPath := cfg.assetPath(langType, tranfolder, tranname)
+	assetsRawData, assetsPMData, err := getPMData(assetsPath)
+	if err != nil {
+		return err
+	}
 
 	os.MkdirAll(filepath.Join(exportRoot, tranfolder), os.ModePerm)
 
 	if paraFile == nil {
-		zap.S().Warnln("paratranz missing file", tranfolder, tranname)
+		logger(ctx).Warnln("paratranz missing file", tranfolder, tranname)
 		err := os.WriteFile(filepath.Join(exportRoot, tranfolder, tranname), assetsRawData, os.ModePerm)
 		if err != nil {
-			zap.S().Fatalln("export WriteFile fail", assetsPath, err)
+			return fmt.Errorf("export WriteFile %s: %w", assetsPath, err)
 		}
-		return
+		return nil
 	}
 
 	var fromTrans []ParatranzTranslation
 
-	err := retryWithBackoff(func() error {
-		trans, err := h.GetTranslation(paraFile.ID)
+	err = retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, paraFile.ID)
 		fromTrans = trans
 		return err
 	})
 	if err != nil {
-		zap.S().Fatalln("GetTranslation", err)
+		return fmt.Errorf("GetTranslation %s: %w", paraFile.Name, err)
 	}
 
 	m := map[string]string{}
@@ -454,67 +465,78 @@ func export(h *ParatranzHandler, langType, tranfolder, tranname string, paraFile
 		m[t.Key] = strings.ReplaceAll(t.Translation, "\\n", "\n")
 	}
 
-	assetsPMData.setFromTranMap(m)
+	if err := assetsPMData.setFromTranMap(m); err != nil {
+		return fmt.Errorf("export %s: %w", assetsPath, err)
+	}
+	hotfix(logger(ctx), assetsPMData, tranfolder, tranname)
 
-	b, err := JSONMarshal(assetsPMData)
+	b, err := assetsPMData.Bytes()
 	if err != nil {
-		zap.S().Fatalln("JSONMarshal", err)
+		logger(ctx).Errorw("export skip file", "file", assetsPath, "error", err)
+		return nil
 	}
 
 	err = os.WriteFile(filepath.Join(exportRoot, tranfolder, tranname), b, os.ModePerm)
 	if err != nil {
-		zap.S().Fatalln("export WriteFile fail", assetsPath, err)
+		return fmt.Errorf("export WriteFile %s: %w", assetsPath, err)
 	}
+	return nil
 }
 
-func syncTran() {
+func syncTran(ctx context.Context) error {
 	zap.S().Infoln("Start sync translation from other project")
 
-	h := NewParatranzHandler(paraid, token)
-	m, err := h.GetFiles()
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
 	if err != nil {
-		zap.S().Fatalln("GetFiles error", paraid, err)
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
 	}
 
-	sourceh := NewParatranzHandler(syncid, token)
-	sourcem, err := sourceh.GetFiles()
+	sourceh := newParatranzHandler(syncid)
+	sourcem, err := sourceh.GetFiles(ctx)
 	if err != nil {
-		zap.S().Fatalln("GetFiles error", syncid, err)
+		return fmt.Errorf("GetFiles %d: %w", syncid, err)
 	}
 
+	done := 0
 	for k, v := range m {
 		if v.Total == v.Translated {
 			// skip all translated file
 			continue
 		}
 		if sourcev, has := sourcem[k]; has {
-			updateTran(sourceh, h, sourcev, v)
+			if err := updateTran(ctx, sourceh, h, sourcev, v); err != nil {
+				return stopped("sync translation", done, len(m), err)
+			}
 		}
+		done++
 	}
+
+	return nil
 }
 
-func updateTran(from, to *ParatranzHandler, fromFile, toFile ParatranzFile) {
+func updateTran(ctx context.Context, from, to *ParatranzHandler, fromFile, toFile ParatranzFile) error {
 	zap.S().Infoln("updateTran", toFile.Name)
 	var fromTrans, toTrans []ParatranzTranslation
 
-	err := retryWithBackoff(func() error {
-		trans, err := from.GetTranslation(fromFile.ID)
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := from.GetTranslation(ctx, fromFile.ID)
 		fromTrans = trans
 		return err
 	})
 
 	if err != nil {
-		zap.S().Fatalln("GetTranslation", err)
+		return fmt.Errorf("GetTranslation %s: %w", fromFile.Name, err)
 	}
 
-	err = retryWithBackoff(func() error {
-		trans, err := to.GetTranslation(toFile.ID)
+	err = retryWithBackoff(ctx, func() error {
+		trans, err := to.GetTranslation(ctx, toFile.ID)
 		toTrans = trans
 		return err
 	})
 
 	if err != nil {
-		zap.S().Fatalln("GetTranslation", err)
+		return fmt.Errorf("GetTranslation %s: %w", toFile.Name, err)
 	}
 
 	m := map[string]ParatranzTranslation{}
@@ -543,156 +565,261 @@ func updateTran(from, to *ParatranzHandler, fromFile, toFile ParatranzFile) {
 
 	d, err := JSONMarshal(toTrans)
 	if err != nil {
-		zap.S().Fatalln("JSONMarshal", err)
+		return fmt.Errorf("JSONMarshal %s: %w", toFile.Name, err)
 	}
 
-	err = retryWithBackoff(func() error {
-		return to.UpdateTranslation(toFile.ID, d, filepath.Base(toFile.Name), true, true)
+	err = retryWithBackoff(ctx, func() error {
+		return to.UpdateTranslation(ctx, toFile.ID, d, filepath.Base(toFile.Name), true, true)
 	})
 
 	if err != nil {
-		zap.S().Fatalln("UpdateTranslation", err)
+		return fmt.Errorf("UpdateTranslation %s: %w", toFile.Name, err)
 	}
 
+	return nil
 }
 
-func updateFromAssets() {
+func updateFromAssets(ctx context.Context) error {
 	zap.S().Infoln("Start update from assets")
 
-	h := NewParatranzHandler(paraid, token)
-	m, err := h.GetFiles()
+	h := newParatranzHandler(paraid)
+
+	j, err := loadJournal()
 	if err != nil {
-		zap.S().Fatalln("GetFiles error", err)
+		return err
 	}
 
-	b, err := os.ReadFile("dump/kr_files.txt")
-	if err != nil {
-		zap.S().Fatalln("read dump/kr_files.txt fail", err)
+	if applyTM && !dryRun {
+		if _, err := sharedTM(); err != nil {
+			return err
+		}
 	}
 
-	lines := strings.Split(string(b), "\n")
+	var changes, contextChanges []assetChange
+	var head string
 
-	updated := map[string]bool{}
+	switch {
+	case j != nil && resumeSync && !dryRun:
+		zap.S().Infow("resume unfinished sync", "head", j.Head, "started", j.StartedAt, "files", len(j.Files))
+		changes, contextChanges = j.changes()
+		head = j.Head
+	case j != nil && !dryRun:
+		return fmt.Errorf("the sync started at %s stopped unfinished, rerun with -resume to continue it or remove %s to start over", j.StartedAt.Format(time.RFC3339), j.path)
+	default:
+		m, err := h.GetFiles(ctx)
+		if err != nil {
+			return fmt.Errorf("GetFiles %d: %w", paraid, err)
+		}
 
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
+		var files map[string][]fileStatus
+		files, head, err = changedFiles(ctx)
+		if err != nil {
+			return err
 		}
-		sp := strings.Split(line, "\t")
-		if len(sp) < 2 {
-			zap.S().Fatalln("files.txt split error:", line)
+
+		changes, contextChanges = collectAssetChanges(m, files)
+
+		thresholdErr := checkDeleteThreshold(changes)
+
+		if dryRun {
+			if thresholdErr != nil {
+				zap.S().Warnln("the real run would stop:", thresholdErr)
+			}
+			return planSync(ctx, h, append(changes, contextChanges...))
 		}
 
-		filetype := sp[0]
-		tranpath, tranname := getTranPath(sp[1])
-		fulltranpath := filepath.Join(tranpath, tranname)
-		updated[fulltranpath] = true
+		if thresholdErr != nil {
+			return thresholdErr
+		}
 
-		switch filetype {
-		case "A":
-			if _, has := m[fulltranpath]; !has {
-				create(h, tranpath, tranname)
+		j = newJournal(head, append(changes, contextChanges...))
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+
+	jobs := []fileJob{}
+	for _, c := range changes {
+		e := j.entry(c.name)
+		jobs = append(jobs, fileJob{name: c.name, run: func(ctx context.Context) error {
+			if e.isDone() {
+				return nil
 			}
-		case "M":
-			if f, has := m[fulltranpath]; !has {
-				create(h, tranpath, tranname)
-			} else {
-				update(h, f, tranpath, tranname)
+
+			var err error
+			switch c.action {
+			case actionCreate:
+				err = create(ctx, h, e, c.folder, c.file)
+			case actionUpdate:
+				if incrementalSync {
+					err = updateIncremental(ctx, h, e, c.pf, c.folder, c.file)
+				} else {
+					err = update(ctx, h, e, c.pf, c.folder, c.file)
+				}
+			case actionMove:
+				err = move(ctx, h, e, c.pf, c.folder, c.file)
+			default:
+				err = e.run(ctx, stepDeleted, func() error { return delete(ctx, h, c.pf) })
 			}
-		case "D":
-			if f, has := m[fulltranpath]; has {
-				delete(h, f)
+			if err != nil {
+				return err
 			}
-		default:
-			zap.S().Errorln("error filetype", filetype, tranpath, tranname)
-		}
+			return e.finish()
+		}})
 	}
 
-	if !assetsContextUpdate {
-		return
+	err = runJobs(ctx, "update", jobs)
+	if reportErr := writeShiftReport(); reportErr != nil {
+		zap.S().Errorln(reportErr)
 	}
-
-	zap.S().Info("Start Update Context from EN")
-
-	enb, err := os.ReadFile("dump/en_files.txt")
 	if err != nil {
-		zap.S().Fatalln("read dump/en_files.txt fail", err)
+		return err
 	}
 
-	enlines := strings.Split(string(enb), "\n")
+	jobs = []fileJob{}
+	for _, c := range contextChanges {
+		e := j.entry(c.name)
+		jobs = append(jobs, fileJob{name: c.name, run: func(ctx context.Context) error {
+			if e.isDone() {
+				return nil
+			}
 
-	for _, line := range enlines {
-		if len(line) == 0 {
-			continue
-		}
-		sp := strings.Split(line, "\t")
-		if len(sp) < 2 {
-			zap.S().Fatalln("files.txt split error:", line)
+			if incrementalSync {
+				if err := updateIncremental(ctx, h, e, c.pf, c.folder, c.file); err != nil {
+					return err
+				}
+				return e.finish()
+			}
+
+			err := e.run(ctx, stepContext, func() error { return updateContext(ctx, h, c.pf, c.folder, c.file) })
+			if err != nil {
+				return err
+			}
+			err = e.run(ctx, stepForces, func() error { return fixByForces(ctx, h, c.pf, c.folder, c.file) })
+			if err != nil {
+				return err
+			}
+			return e.finish()
+		}})
+	}
+
+	if len(jobs) > 0 {
+		if err := runJobs(ctx, "update context", jobs); err != nil {
+			return err
 		}
+	}
+
+	if err := recordSyncedCommit(head); err != nil {
+		return err
+	}
+	return j.finish()
+}
+
+const (
+	actionCreate  = "create"
+	actionUpdate  = "update"
+	actionDelete  = "delete"
+	actionMove    = "move"
+	actionContext = "context"
+)
 
-		filetype := sp[0]
-		tranpath, tranname := getLangTranPath(sp[1], "en")
+// assetChange is one file that a sync would touch on paratranz. For a move
+// pf is the file under its old name.
+type assetChange struct {
+	action string
+	name   string
+	folder string
+	file   string
+	pf     ParatranzFile
+}
+
+// collectAssetChanges turns the changed source files into the files to
+// create, update, move or delete, and the changed context files into the
+// files that only need a context refresh.
+func collectAssetChanges(m map[string]ParatranzFile, files map[string][]fileStatus) ([]assetChange, []assetChange) {
+	updated := map[string]bool{}
+
+	changes := []assetChange{}
+	for _, fst := range files[cfg.SourceLang] {
+		tranpath, tranname := getTranPath(fst.path)
 		fulltranpath := filepath.Join(tranpath, tranname)
-		if _, has := updated[fulltranpath]; has {
-			continue
-		}
 		updated[fulltranpath] = true
 
-		switch filetype {
-		case "A":
-		case "M":
-			if f, has := m[fulltranpath]; has {
-				updateContext(h, f, tranpath, tranname)
-				fixByForces(h, f, tranpath, tranname)
+		c := assetChange{name: fulltranpath, folder: tranpath, file: tranname}
+		f, has := m[fulltranpath]
+		switch fst.status {
+		case 'A':
+			if !has {
+				c.action = actionCreate
 			}
-		case "D":
-		default:
-			zap.S().Errorln("error filetype", filetype, tranpath, tranname)
+		case 'M':
+			if !has {
+				c.action = actionCreate
+			} else {
+				c.action, c.pf = actionUpdate, f
+			}
+		case 'R':
+			fromfolder, fromname := getTranPath(fst.from)
+			fromfull := filepath.Join(fromfolder, fromname)
+			updated[fromfull] = true
+
+			from, hasFrom := m[fromfull]
+			switch {
+			case hasFrom && !has:
+				c.action, c.pf = actionMove, from
+			case hasFrom:
+				changes = append(changes, assetChange{action: actionDelete, name: fromfull, folder: fromfolder, file: fromname, pf: from})
+				fallthrough
+			case has:
+				c.action, c.pf = actionUpdate, f
+			default:
+				c.action = actionCreate
+			}
+		case 'D':
+			if has {
+				c.action, c.pf = actionDelete, f
+			}
+		}
+		if c.action != "" {
+			changes = append(changes, c)
 		}
 	}
 
-	zap.S().Info("Start Update Context from JP")
-
-	jpb, err := os.ReadFile("dump/jp_files.txt")
-	if err != nil {
-		zap.S().Fatalln("read dump/jp_files.txt fail", err)
+	if !assetsContextUpdate {
+		return changes, nil
 	}
 
-	jplines := strings.Split(string(jpb), "\n")
-
-	for _, line := range jplines {
-		if len(line) == 0 {
-			continue
-		}
-		sp := strings.Split(line, "\t")
-		if len(sp) < 2 {
-			zap.S().Fatalln("files.txt split error:", line)
-		}
+	contextChanges := []assetChange{}
+	for _, lang := range cfg.ContextLangs {
+		for _, fst := range files[lang] {
+			if fst.status != 'M' && fst.status != 'R' {
+				continue
+			}
 
-		filetype := sp[0]
-		tranpath, tranname := getLangTranPath(sp[1], "jp")
-		fulltranpath := filepath.Join(tranpath, tranname)
-		if _, has := updated[fulltranpath]; has {
-			continue
-		}
-		updated[fulltranpath] = true
+			tranpath, tranname := getLangTranPath(fst.path, lang)
+			fulltranpath := filepath.Join(tranpath, tranname)
+			if _, has := updated[fulltranpath]; has {
+				continue
+			}
+			updated[fulltranpath] = true
 
-		switch filetype {
-		case "A":
-		case "M":
 			if f, has := m[fulltranpath]; has {
-				updateContext(h, f, tranpath, tranname)
-				fixByForces(h, f, tranpath, tranname)
+				contextChanges = append(contextChanges, assetChange{action: actionContext, name: fulltranpath, folder: tranpath, file: tranname, pf: f})
 			}
-		case "D":
-		default:
-			zap.S().Errorln("error filetype", filetype, tranpath, tranname)
 		}
 	}
+
+	return changes, contextChanges
 }
 
+// PMData is a game text asset. Edits made through setFromTranMap and set
+// are also recorded against the raw file, see Bytes.
 type PMData struct {
 	DataList []map[string]any `json:"dataList"`
+
+	raw     []byte
+	edits   map[string][]byte
+	deletes map[string]bool
 }
 
 func recursionGetPMData(v any, keys []string, m map[string]string) {
@@ -718,24 +845,35 @@ func recursionGetPMData(v any, keys []string, m map[string]string) {
 	}
 }
 
+// getTranMap returns every string of the asset keyed by the configured key
+// strategy.
 func (pm *PMData) getTranMap() map[string]string {
+	return pm.rekey(pm.indexTranMap())
+}
+
+func (pm *PMData) indexTranMap() map[string]string {
 	m := map[string]string{}
 	keys := []string{"dataList"}
 	recursionGetPMData(pm.DataList, keys, m)
 	return m
 }
 
-func recursionSetPMData(v any, keys []string, m map[string]string) (string, bool) {
+func recursionSetPMData(v any, keys []string, m map[string]string, changed map[string]string) (string, bool) {
 	switch vt := v.(type) {
 	case string:
-		return m[strings.Join(keys, "->")], vt != "" && m[strings.Join(keys, "->")] != ""
+		key := strings.Join(keys, "->")
+		setv := m[key]
+		if vt != "" && setv != "" && setv != vt {
+			changed[key] = setv
+		}
+		return setv, vt != "" && setv != ""
 	case []map[string]any:
 		for i, mapv := range vt {
 			for k, subv := range mapv {
 				if k == "id" || k == "model" {
 					continue
 				}
-				if setv, ok := recursionSetPMData(subv, append(keys, strconv.Itoa(i), k), m); ok {
+				if setv, ok := recursionSetPMData(subv, append(keys, strconv.Itoa(i), k), m, changed); ok {
 					vt[i][k] = setv
 				}
 			}
@@ -745,13 +883,13 @@ func recursionSetPMData(v any, keys []string, m map[string]string) (string, bool
 			if k == "id" || k == "model" {
 				continue
 			}
-			if setv, ok := recursionSetPMData(subv, append(keys, k), m); ok {
+			if setv, ok := recursionSetPMData(subv, append(keys, k), m, changed); ok {
 				vt[k] = setv
 			}
 		}
 	case []any:
 		for i, subv := range vt {
-			if setv, ok := recursionSetPMData(subv, append(keys, strconv.Itoa(i)), m); ok {
+			if setv, ok := recursionSetPMData(subv, append(keys, strconv.Itoa(i)), m, changed); ok {
 				vt[i] = setv
 			}
 		}
@@ -760,9 +898,19 @@ func recursionSetPMData(v any, keys []string, m map[string]string) (string, bool
 	return "", false
 }
 
-func (pm *PMData) setFromTranMap(m map[string]string) {
+func (pm *PMData) setFromTranMap(m map[string]string) error {
 	keys := []string{"dataList"}
-	recursionSetPMData(pm.DataList, keys, m)
+	changed := map[string]string{}
+	recursionSetPMData(pm.DataList, keys, pm.indexKeys(m), changed)
+
+	for key, v := range changed {
+		value, err := encodeJSONValue(v)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", key, err)
+		}
+		pm.edit(key, value)
+	}
+	return nil
 }
 
 func getPMData(filepath string) ([]byte, *PMData, error) {
@@ -772,143 +920,320 @@ func getPMData(filepath string) ([]byte, *PMData, error) {
 		return nil, nil, err
 	}
 
-	pm := PMData{}
-	err = json.Unmarshal(bytes.TrimPrefix(RawData, []byte{0xEF, 0xBB, 0xBF}), &pm)
+	pm := PMData{raw: RawData}
+	err = json.Unmarshal(bytes.TrimPrefix(RawData, utf8BOM), &pm)
 	if err != nil {
-		zap.S().Fatalln("Unmarshal error", filepath, err)
+		return nil, nil, fmt.Errorf("parse %s: %w", filepath, err)
 	}
 	return RawData, &pm, nil
 }
 
-func create(h *ParatranzHandler, tranfolder, tranname string) {
-	zap.S().Infoln("create", tranfolder, tranname)
-	krPath := filepath.Join("Assets/kr", tranfolder, "KR_"+tranname)
+func create(ctx context.Context, h *ParatranzHandler, e *journalEntry, tranfolder, tranname string) error {
+	logger(ctx).Infoln("create", tranfolder, tranname)
+
+	parafile, err := e.uploaded(ctx, func() (*ParatranzFile, error) {
+		return upload(ctx, h, tranfolder, tranname)
+	})
+	if err != nil || parafile == nil {
+		return err
+	}
+
+	// update context
+	err = e.run(ctx, stepContext, func() error { return updateContext(ctx, h, *parafile, tranfolder, tranname) })
+	if err != nil {
+		return err
+	}
+	err = e.run(ctx, stepForces, func() error { return fixByForces(ctx, h, *parafile, tranfolder, tranname) })
+	if err != nil || !applyTM {
+		return err
+	}
+	return e.run(ctx, stepTM, func() error { return fillFromTM(ctx, h, *parafile) })
+}
+
+// upload sends a KR file as a new paratranz file, it returns nil for files
+// without strings.
+func upload(ctx context.Context, h *ParatranzHandler, tranfolder, tranname string) (*ParatranzFile, error) {
+	krPath := cfg.sourcePath(tranfolder, tranname)
 
-	krRawData, krPMData, _ := getPMData(krPath)
+	_, krPMData, err := getPMData(krPath)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(krPMData.DataList) == 0 {
-		zap.S().Errorln("skip empty file", krPath)
-		return
+		logger(ctx).Errorln("skip empty file", krPath)
+		return nil, nil
+	}
+
+	krRawData, err := krPMData.uploadData()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", krPath, err)
 	}
 
 	var parafile *ParatranzFile
 
 	// upload new file
-	err := retryWithBackoff(func() error {
-		f, err := h.UploadFile(krRawData, tranfolder, tranname)
+	err = retryWithBackoff(ctx, func() error {
+		f, err := h.UploadFile(ctx, krRawData, tranfolder, tranname)
 		parafile = f
 		return err
 	})
 
 	if err != nil {
-		if err.Error() == ParatranzEmptySkip {
-			zap.S().Warnln("UploadFile empty skip", krPath, err)
-			return
+		if errors.Is(err, ErrEmptyFile) {
+			logger(ctx).Warnln("UploadFile empty skip", krPath, err)
+			return nil, nil
 		}
-		zap.S().Fatalln("UploadFile fial", krPath, err)
+		return nil, fmt.Errorf("UploadFile %s: %w", krPath, err)
 	}
-
-	// update context
-	updateContext(h, *parafile, tranfolder, tranname)
-	fixByForces(h, *parafile, tranfolder, tranname)
+	return parafile, nil
 }
 
-func delete(h *ParatranzHandler, pf ParatranzFile) {
-	zap.S().Infoln("delete", pf.Name, pf.ID)
+// move uploads a renamed KR file under its new name, carries over the
+// translations of the old file and deletes the old one.
+func move(ctx context.Context, h *ParatranzHandler, e *journalEntry, from ParatranzFile, tranfolder, tranname string) error {
+	logger(ctx).Infoln("move", from.Name, "to", tranfolder, tranname)
 
-	err := retryWithBackoff(func() error {
-		return h.DeleteFile(pf.ID)
+	oldtrans, err := e.originals(ctx, func() ([]ParatranzTranslation, error) {
+		var oldtrans []ParatranzTranslation
+		err := retryWithBackoff(ctx, func() error {
+			trans, err := h.GetTranslation(ctx, from.ID)
+			oldtrans = trans
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetTranslation %s %d: %w", from.Name, from.ID, err)
+		}
+		return oldtrans, nil
 	})
 	if err != nil {
-		zap.S().Fatalln("upload DeleteFile fial", pf.ID, err)
+		return err
+	}
+
+	pf, err := e.uploaded(ctx, func() (*ParatranzFile, error) {
+		return upload(ctx, h, tranfolder, tranname)
+	})
+	if err != nil {
+		return err
+	}
+
+	if pf != nil {
+		err = e.run(ctx, stepContext, func() error { return updateContext(ctx, h, *pf, tranfolder, tranname) })
+		if err != nil {
+			return err
+		}
+		err = e.run(ctx, stepCopied, func() error { return copyByKey(ctx, h, *pf, oldtrans) })
+		if err != nil {
+			return err
+		}
+		err = e.run(ctx, stepForces, func() error { return fixByForces(ctx, h, *pf, tranfolder, tranname) })
+		if err != nil {
+			return err
+		}
+		err = e.run(ctx, stepShift, func() error { return fixFileShift(ctx, h, *pf, oldtrans, tranfolder, tranname) })
+		if err != nil {
+			return err
+		}
 	}
+
+	return e.run(ctx, stepDeleted, func() error { return delete(ctx, h, from) })
 }
 
-func update(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname string) {
-	zap.S().Infoln("update", pf.ID, tranfolder, tranname)
+// copyByKey puts translations and stages of oldtrans on the strings of pf
+// with the same key and original.
+func copyByKey(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, oldtrans []ParatranzTranslation) error {
+	old := map[string]ParatranzTranslation{}
+	for _, t := range oldtrans {
+		if t.Translation != "" || t.Stage != 0 {
+			old[t.Key] = t
+		}
+	}
 
-	krPath := filepath.Join("Assets/kr", tranfolder, "KR_"+tranname)
+	var newtrans []ParatranzTranslation
 
-	krRawData, krPMData, _ := getPMData(krPath)
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, pf.ID)
+		newtrans = trans
+		return err
+	})
 
-	if len(krPMData.DataList) == 0 {
-		zap.S().Errorln("skip empty file", krPath)
-		return
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	copied := []ParatranzTranslation{}
+	for _, t := range newtrans {
+		if o, has := old[t.Key]; has && o.Original == t.Original {
+			t.Translation, t.Stage = o.Translation, o.Stage
+			copied = append(copied, t)
+		}
+	}
+
+	if len(copied) == 0 {
+		return nil
+	}
+
+	logger(ctx).Infow("copy translations", "file", pf.Name, "count", len(copied))
+
+	b, err := JSONMarshal(copied)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal %s: %w", pf.Name, err)
 	}
 
-	var oldtrans []ParatranzTranslation
+	err = retryWithBackoff(ctx, func() error {
+		return h.UpdateTranslation(ctx, pf.ID, b, pf.Name, true, true)
+	})
 
-	err := retryWithBackoff(func() error {
-		trans, err := h.GetTranslation(pf.ID)
-		oldtrans = trans
+	if err != nil {
+		return fmt.Errorf("UpdateTranslation %s: %w", pf.Name, err)
+	}
+	return nil
+}
+
+func delete(ctx context.Context, h *ParatranzHandler, pf ParatranzFile) error {
+	logger(ctx).Infoln("delete", pf.Name, pf.ID)
+
+	archivePath, err := archiveFile(ctx, h, pf)
+	if err != nil {
 		return err
+	}
+	logger(ctx).Infoln("archived before delete", pf.Name, archivePath)
+
+	err = retryWithBackoff(ctx, func() error {
+		return h.DeleteFile(ctx, pf.ID)
 	})
+	if err != nil {
+		return fmt.Errorf("DeleteFile %s %d: %w", pf.Name, pf.ID, err)
+	}
+	return nil
+}
+
+func update(ctx context.Context, h *ParatranzHandler, e *journalEntry, pf ParatranzFile, tranfolder, tranname string) error {
+	logger(ctx).Infoln("update", pf.ID, tranfolder, tranname)
 
+	krPath := cfg.sourcePath(tranfolder, tranname)
+
+	_, krPMData, err := getPMData(krPath)
 	if err != nil {
-		zap.S().Fatalln("GetTranslation", pf.Name, pf.ID, err)
+		return err
 	}
 
-	// upload new file
-	err = retryWithBackoff(func() error {
-		err := h.UpdateFile(pf.ID, krRawData, tranfolder, tranname, false)
+	if len(krPMData.DataList) == 0 {
+		logger(ctx).Errorln("skip empty file", krPath)
+		return nil
+	}
+
+	krRawData, err := krPMData.uploadData()
+	if err != nil {
+		return fmt.Errorf("%s: %w", krPath, err)
+	}
+
+	oldtrans, err := e.originals(ctx, func() ([]ParatranzTranslation, error) {
+		var oldtrans []ParatranzTranslation
+		err := retryWithBackoff(ctx, func() error {
+			trans, err := h.GetTranslation(ctx, pf.ID)
+			oldtrans = trans
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+		}
+		return oldtrans, nil
+	})
+	if err != nil {
 		return err
+	}
+
+	// upload new file
+	err = e.run(ctx, stepUploaded, func() error {
+		err := retryWithBackoff(ctx, func() error {
+			return h.UpdateFile(ctx, pf.ID, krRawData, tranfolder, tranname, false)
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateFile %s: %w", krPath, err)
+		}
+		return nil
 	})
 
 	if err != nil {
-		if err.Error() == ParatranzEmptySkip {
-			zap.S().Errorln("UpdateFile empty skip", krPath, err)
-			return
+		if errors.Is(err, ErrEmptyFile) {
+			logger(ctx).Errorln("UpdateFile empty skip", krPath, err)
+			return nil
 		}
-		zap.S().Fatalln("UpdateFile fial", krPath, err)
+		return err
 	}
 
-	updateContext(h, pf, tranfolder, tranname)
-	fixByForces(h, pf, tranfolder, tranname)
+	err = e.run(ctx, stepContext, func() error { return updateContext(ctx, h, pf, tranfolder, tranname) })
+	if err != nil {
+		return err
+	}
+	err = e.run(ctx, stepForces, func() error { return fixByForces(ctx, h, pf, tranfolder, tranname) })
+	if err != nil {
+		return err
+	}
 
-	fixFileShift(h, pf, oldtrans, tranfolder, tranname)
+	return e.run(ctx, stepShift, func() error { return fixFileShift(ctx, h, pf, oldtrans, tranfolder, tranname) })
 }
 
-func updateContext(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname string) {
-	zap.S().Infoln("updateContext", pf.ID, tranfolder, tranname)
+func updateContext(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname string) error {
+	logger(ctx).Infoln("updateContext", pf.ID, tranfolder, tranname)
 
-	krPath := filepath.Join("Assets/kr", tranfolder, "KR_"+tranname)
-	enPath := filepath.Join("Assets/en", tranfolder, "EN_"+tranname)
-	jpPath := filepath.Join("Assets/jp", tranfolder, "JP_"+tranname)
+	krPath := cfg.sourcePath(tranfolder, tranname)
 
 	var filetrans []ParatranzTranslation
 
-	err := retryWithBackoff(func() error {
-		trans, err := h.GetTranslation(pf.ID)
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, pf.ID)
 		filetrans = trans
 		return err
 	})
 
 	if err != nil {
-		zap.S().Fatalln("GetTranslation", pf.Name, pf.ID, err)
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
 	}
 
-	_, enPMData, enerr := getPMData(enPath)
-	_, jpPMData, jperr := getPMData(jpPath)
+	finaltrans := withContext(filetrans, tranfolder, tranname)
+
+	tranb, err := JSONMarshal(finaltrans)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	err = retryWithBackoff(ctx, func() error {
+		return h.UpdateFile(ctx, pf.ID, tranb, tranfolder, tranname, true)
+	})
 
-	enTran := map[string]string{}
-	if enerr == nil {
-		enTran = enPMData.getTranMap()
+	if err != nil {
+		return fmt.Errorf("UpdateFile %s: %w", krPath, err)
 	}
-	jpTran := map[string]string{}
-	if jperr == nil {
-		jpTran = jpPMData.getTranMap()
+	return nil
+}
+
+// withContext sets the text of every context language as context of each
+// string and drops strings without an original.
+func withContext(filetrans []ParatranzTranslation, tranfolder, tranname string) []ParatranzTranslation {
+	langTran := make([]map[string]string, len(cfg.ContextLangs))
+	for i, lang := range cfg.ContextLangs {
+		langTran[i] = map[string]string{}
+		if _, pm, err := getPMData(cfg.assetPath(lang, tranfolder, tranname)); err == nil {
+			langTran[i] = pm.getTranMap()
+		}
 	}
 
 	for i, tran := range filetrans {
-		enContext := enTran[tran.Key]
-		jpContext := jpTran[tran.Key]
+		sameAsOriginal := true
+		parts := make([]string, len(cfg.ContextLangs))
+		for j, lang := range cfg.ContextLangs {
+			text := langTran[j][tran.Key]
+			sameAsOriginal = sameAsOriginal && text == tran.Original
+			parts[j] = fmt.Sprintf("%s:\n%s", strings.ToUpper(lang), text)
+		}
 
 		// id and model skip context
-		if tran.Original == enContext && tran.Original == jpContext &&
-			(strings.HasSuffix(tran.Key, "->id") || strings.HasSuffix(tran.Key, "->model")) {
+		if sameAsOriginal && (strings.HasSuffix(tran.Key, "->id") || strings.HasSuffix(tran.Key, "->model")) {
 			continue
 		}
-		filetrans[i].Context = fmt.Sprintf("EN:\n%s\n\nJP:\n%s", enContext, jpContext)
+		filetrans[i].Context = strings.Join(parts, "\n\n")
 	}
 
 	finaltrans := []ParatranzTranslation{}
@@ -919,33 +1244,22 @@ func updateContext(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname s
 		}
 	}
 
-	tranb, err := JSONMarshal(finaltrans)
-	if err != nil {
-		zap.S().Fatalln("JSONMarshal", pf.Name, pf.ID, filetrans, err)
-	}
-
-	err = retryWithBackoff(func() error {
-		return h.UpdateFile(pf.ID, tranb, tranfolder, tranname, true)
-	})
-
-	if err != nil {
-		zap.S().Fatalln("UpdateFile fial", krPath, err)
-	}
+	return finaltrans
 }
 
-func fixByForces(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname string) {
-	zap.S().Infoln("fixByForces", pf.ID, tranfolder, tranname)
+func fixByForces(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname string) error {
+	logger(ctx).Infoln("fixByForces", pf.ID, tranfolder, tranname)
 
 	var filetrans []ParatranzTranslation
 
-	err := retryWithBackoff(func() error {
-		trans, err := h.GetTranslation(pf.ID)
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, pf.ID)
 		filetrans = trans
 		return err
 	})
 
 	if err != nil {
-		zap.S().Fatalln("GetTranslation", pf.Name, pf.ID, err)
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
 	}
 
 	forces := []ParatranzTranslation{}
@@ -954,7 +1268,7 @@ func fixByForces(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname str
 		if tran.Original != "" {
 			if tran.Stage == -1 {
 				forces = append(forces, tran)
-				zap.S().Infoln("stage -1:", tran.Key)
+				logger(ctx).Infoln("stage -1:", tran.Key)
 			} else if strings.HasSuffix(tran.Key, "->id") || strings.HasSuffix(tran.Key, "->model") {
 				if tran.Stage == 0 && tran.Original != tran.Translation {
 					tran.Translation = tran.Original
@@ -965,7 +1279,7 @@ func fixByForces(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname str
 	}
 
 	if len(forces) != 0 {
-		zap.S().Infoln("fix forces count", len(forces))
+		logger(ctx).Infoln("fix forces count", len(forces))
 
 		for i, tran := range forces {
 			forces[i].Stage = 0
@@ -976,81 +1290,28 @@ func fixByForces(h *ParatranzHandler, pf ParatranzFile, tranfolder, tranname str
 
 		tranb, err := JSONMarshal(forces)
 		if err != nil {
-			zap.S().Fatalln("JSONMarshal", pf.Name, pf.ID, forces, err)
+			return fmt.Errorf("JSONMarshal %s %d: %w", pf.Name, pf.ID, err)
 		}
 
-		err = retryWithBackoff(func() error {
-			return h.UpdateTranslation(pf.ID, tranb, pf.Name, true, true)
+		err = retryWithBackoff(ctx, func() error {
+			return h.UpdateTranslation(ctx, pf.ID, tranb, pf.Name, true, true)
 		})
 		if err != nil {
-			zap.S().Fatalln("UpdateTranslation fial", tranfolder, tranname, err)
+			return fmt.Errorf("UpdateTranslation %s %s: %w", tranfolder, tranname, err)
 		}
 	}
 
-}
-
-func fixFileShift(h *ParatranzHandler, pf ParatranzFile, oldtrans []ParatranzTranslation, tranfolder, tranname string) {
-	zap.S().Infoln("fixFileShift", pf.ID, tranfolder, tranname)
-
-	m := map[string]string{}
-
-	for _, t := range oldtrans {
-		if !strings.HasSuffix(t.Key, "->id") && !strings.HasSuffix(t.Key, "->model") && t.Stage != 0 && t.Translation != "" {
-			m[t.Original] = t.Translation
-		}
-	}
-
-	var newtrans []ParatranzTranslation
-
-	err := retryWithBackoff(func() error {
-		trans, err := h.GetTranslation(pf.ID)
-		newtrans = trans
-		return err
-	})
-
-	if err != nil {
-		zap.S().Fatalln("GetTranslation", pf.Name, pf.ID, err)
-	}
-
-	fixtrans := []ParatranzTranslation{}
-
-	for _, t := range newtrans {
-		if t.Stage == 0 && !strings.HasSuffix(t.Key, "->id") && !strings.HasSuffix(t.Key, "->model") {
-			if v, match := m[t.Original]; match {
-				t.Translation = v
-				fixtrans = append(fixtrans, t)
-			}
-		}
-	}
-
-	if len(fixtrans) == 0 {
-		return
-	}
-
-	zap.S().Infow("fix shift", "count", len(fixtrans))
-
-	b, err := JSONMarshal(fixtrans)
-	if err != nil {
-		zap.S().Fatalln("JSONMarshal", err)
-	}
-
-	err = retryWithBackoff(func() error {
-		return h.UpdateTranslation(pf.ID, b, pf.Name, true, false)
-	})
-
-	if err != nil {
-		zap.S().Fatalln("UpdateTranslation error", pf.Name, err)
-	}
+	return nil
 }
 
 func getTranPath(krpath string) (filder string, name string) {
-	return getLangTranPath(krpath, "kr")
+	return getLangTranPath(krpath, cfg.SourceLang)
 }
 
 func getLangTranPath(assetspath string, langType string) (filder string, name string) {
-	assetspath = assetspath[3:]
+	assetspath = strings.TrimPrefix(assetspath, langType+"/")
 	filder = filepath.Dir(assetspath)
-	name = strings.TrimPrefix(filepath.Base(assetspath), strings.ToUpper(langType)+"_")
+	name = strings.TrimPrefix(filepath.Base(assetspath), cfg.prefix(langType))
 	return filder, name
 }
 
@@ -1062,74 +1323,75 @@ func JSONMarshal(t interface{}) ([]byte, error) {
 	return buffer.Bytes(), err
 }
 
-func retryWithBackoff(fn func() error) error {
-	for {
-		err := fn()
-		if err == nil || err.Error() != ParatranzRetry {
-			return err
-		}
-		zap.S().Warnln("retrying after error:", err)
-		time.Sleep(30 * time.Second)
-	}
-}
-
-func exportUntranslateStory() {
+func exportUntranslateStory(ctx context.Context) error {
 	zap.S().Infoln("Start exportUntranslateStory")
 
-	h := NewParatranzHandler(paraid, token)
-	m, err := h.GetFiles()
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
 	if err != nil {
-		zap.S().Fatalln("GetFiles error", err)
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
 	}
 
 	amt := map[string]string{}
+	mu := sync.Mutex{}
 
-	for k, v := range m {
-
-		if !strings.Contains(k, "StoryData") || v.Total == v.Translated {
+	jobs := []fileJob{}
+	for _, v := range sortedFiles(m) {
+		if !strings.Contains(v.Name, "StoryData") || v.Total == v.Translated {
 			// skip all translated file
 			continue
 		}
 
-		var filetrans []ParatranzTranslation
+		jobs = append(jobs, fileJob{name: v.Name, run: func(ctx context.Context) error {
+			var filetrans []ParatranzTranslation
 
-		mt := map[string]string{}
+			mt := map[string]string{}
 
-		err := retryWithBackoff(func() error {
-			trans, err := h.GetTranslation(v.ID)
-			filetrans = trans
-			return err
-		})
+			err := retryWithBackoff(ctx, func() error {
+				trans, err := h.GetTranslation(ctx, v.ID)
+				filetrans = trans
+				return err
+			})
 
-		if err != nil {
-			zap.S().Fatalln("GetTranslation", v.Name, v.ID, err)
-		}
+			if err != nil {
+				return fmt.Errorf("GetTranslation %s %d: %w", v.Name, v.ID, err)
+			}
 
-		for _, t := range filetrans {
-			if t.Translation != "" || t.Stage != 0 || strings.HasSuffix(t.Key, "->id") || strings.HasSuffix(t.Key, "->model") || strings.HasSuffix(t.Key, "->teacher") {
-				continue
+			for _, t := range filetrans {
+				if t.Translation != "" || t.Stage != 0 || strings.HasSuffix(t.Key, "->id") || strings.HasSuffix(t.Key, "->model") || strings.HasSuffix(t.Key, "->teacher") {
+					continue
+				}
+
+				mt[t.Original] = ""
 			}
 
-			mt[t.Original] = ""
-			amt[t.Original] = ""
-		}
+			mu.Lock()
+			for k := range mt {
+				amt[k] = ""
+			}
+			mu.Unlock()
 
-		os.MkdirAll(filepath.Join("dump", "UT", v.Folder), os.ModePerm)
-		b, err := JSONMarshal(mt)
-		if err != nil {
-			zap.S().Fatalln("JSONMarshal", err)
-		}
+			os.MkdirAll(cfg.dumpPath("UT", v.Folder), os.ModePerm)
+			b, err := JSONMarshal(mt)
+			if err != nil {
+				return fmt.Errorf("JSONMarshal %s: %w", v.Name, err)
+			}
 
-		os.WriteFile(filepath.Join("dump", "UT", v.Name), b, os.ModePerm)
+			return os.WriteFile(cfg.dumpPath("UT", v.Name), b, os.ModePerm)
+		}})
+	}
 
+	if err := runJobs(ctx, "export untranslate", jobs); err != nil {
+		return err
 	}
+
 	b, err := JSONMarshal(amt)
 	if err != nil {
-		zap.S().Fatalln("JSONMarshal", err)
+		return fmt.Errorf("JSONMarshal ut: %w", err)
 	}
-	os.WriteFile(filepath.Join("dump", "UT", "ut.json"), b, os.ModePerm)
+	os.WriteFile(cfg.dumpPath("UT", "ut.json"), b, os.ModePerm)
 
-	sfilename := filepath.Join("dump", "UT", "ut.split.json")
+	sfilename := cfg.dumpPath("UT", "ut.split.json")
 	os.Remove(sfilename)
 
 	sb := []byte{}
@@ -1139,7 +1401,7 @@ func exportUntranslateStory() {
 		if len(smt) >= 90 {
 			ssb, err := JSONMarshal(smt)
 			if err != nil {
-				zap.S().Fatalln("JSONMarshal", err)
+				return fmt.Errorf("JSONMarshal ut split: %w", err)
 			}
 			sb = append(sb, ssb...)
 			clear(smt)
@@ -1149,10 +1411,11 @@ func exportUntranslateStory() {
 	if len(smt) != 0 {
 		ssb, err := JSONMarshal(smt)
 		if err != nil {
-			zap.S().Fatalln("JSONMarshal", err)
+			return fmt.Errorf("JSONMarshal ut split: %w", err)
 		}
 		sb = append(sb, ssb...)
 	}
 
-	os.WriteFile(filepath.Join("dump", "UT", "ut.split.json"), sb, os.ModePerm)
+	os.WriteFile(cfg.dumpPath("UT", "ut.split.json"), sb, os.ModePerm)
+	return nil
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ParatranzUploader/paratranztest"
+)
+
+// chdir runs the test from dir, the uploader works on paths relative to the
+// working directory.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// writeAsset writes a language file of the test assets, one entry per
+// content.
+func writeAsset(t *testing.T, root, lang, name string, contents ...string) {
+	t.Helper()
+
+	entries := []string{}
+	for i, c := range contents {
+		b, _ := json.Marshal(c)
+		entries = append(entries, `{"id": `+strconv.Itoa(i+1)+`, "model": "m`+strconv.Itoa(i+1)+`", "content": `+string(b)+`}`)
+	}
+	p := filepath.Join(root, lang, "StoryData", strings.ToUpper(lang)+"_"+name)
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	data := "\xef\xbb\xbf{\n  \"dataList\": [\n    " + strings.Join(entries, ",\n    ") + "\n  ]\n}\n"
+	if err := os.WriteFile(p, []byte(data), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stringsByKey(strs []paratranztest.String) map[string]paratranztest.String {
+	m := map[string]paratranztest.String{}
+	for _, s := range strs {
+		m[s.Key] = s
+	}
+	return m
+}
+
+// TestCreateUpdateExport creates a file from the assets, updates it after an
+// entry was inserted in front of the translated ones and exports it.
+func TestCreateUpdateExport(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	h := newParatranzHandler(paraid)
+	ctx := context.Background()
+
+	writeAsset(t, "Assets", "kr", "Test.json", "안녕", "세계")
+	writeAsset(t, "Assets", "en", "Test.json", "Hello", "World")
+	writeAsset(t, "Assets", "jp", "Test.json", "こんにちは", "世界")
+	if err := create(ctx, h, nil, "StoryData", "Test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, has := srv.Files(1)["StoryData/Test.json"]
+	if !has {
+		t.Fatalf("file not created, have %v", srv.Files(1))
+	}
+	strs := stringsByKey(srv.Strings(1, f.ID))
+	if got := strs["dataList->1->content"]; got.Original != "세계" || !strings.Contains(got.Context, "World") || !strings.Contains(got.Context, "世界") {
+		t.Fatalf("created string %+v, want the KR original with EN and JP context", got)
+	}
+
+	tb, _ := json.Marshal([]ParatranzTranslation{
+		{Key: "dataList->0->content", Translation: "你好", Stage: 5},
+		{Key: "dataList->1->content", Translation: "世界", Stage: 5},
+	})
+	if err := h.UpdateTranslation(ctx, f.ID, tb, f.Name, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// every key moves by one
+	writeAsset(t, "Assets", "kr", "Test.json", "새로운", "안녕", "세계")
+	writeAsset(t, "Assets", "en", "Test.json", "New", "Hello", "World")
+	writeAsset(t, "Assets", "jp", "Test.json", "新しい", "こんにちは", "世界")
+	files, err := h.GetFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := update(ctx, h, nil, files[f.Name], "StoryData", "Test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	strs = stringsByKey(srv.Strings(1, f.ID))
+	for key, want := range map[string]string{"dataList->0->content": "", "dataList->1->content": "你好", "dataList->2->content": "世界"} {
+		if got := strs[key]; got.Translation != want {
+			t.Errorf("%s = %q after the update, want %q", key, got.Translation, want)
+		}
+	}
+
+	os.MkdirAll("dump", os.ModePerm)
+	if err := os.WriteFile(filepath.Join("dump", "en_files.txt"), []byte("M\ten/StoryData/EN_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportAssets(ctx, "en"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, pm, err := getPMData(filepath.Join(cfg.exportDir(), "StoryData", "Test.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pm.getTranMap()
+	for key, want := range map[string]string{"dataList->0->content": "New", "dataList->1->content": "你好", "dataList->2->content": "世界"} {
+		if got[key] != want {
+			t.Errorf("exported %s = %q, want %q", key, got[key], want)
+		}
+	}
+}
+
+func gitCommit(t *testing.T, repo, msg string) {
+	t.Helper()
+
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", msg}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+}
+
+func runCommand(t *testing.T, srv *paratranztest.Server, config string, args ...string) {
+	t.Helper()
+
+	args = append(args[:1:1], append([]string{"-config", config, "-id", "1", "-token", "test", "-api-root", srv.APIRoot(), "-rate-limit", "0"}, args[1:]...)...)
+	code := runMain(args)
+	// the snapshot of the run must not catch writes of the next one
+	currentRun = nil
+	if code != exitOK {
+		t.Fatalf("%s exited with %d", strings.Join(args, " "), code)
+	}
+}
+
+// TestSyncExport creates a file from the assets, updates it after an entry
+// was inserted in front of the translated ones and exports it, with the
+// fake server rate limiting and failing once on the way.
+func TestSyncExport(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	assets := filepath.Join(dir, "Assets")
+	os.MkdirAll(assets, os.ModePerm)
+	if out, err := exec.Command("git", "init", "-q", assets).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	gitCommit(t, assets, "empty")
+
+	config := filepath.Join(dir, "paratranz.json")
+	b, _ := json.Marshal(map[string]string{
+		"assetsRoot":  assets,
+		"dumpDir":     filepath.Join(dir, "dump"),
+		"downloadDir": filepath.Join(dir, "download"),
+		"exportRoot":  filepath.Join(dir, "export"),
+		"hotfixFile":  "",
+	})
+	if err := os.WriteFile(config, b, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+
+	// create
+	writeAsset(t, assets, "kr", "Test.json", "안녕", "세계")
+	writeAsset(t, assets, "en", "Test.json", "Hello", "World")
+	writeAsset(t, assets, "jp", "Test.json", "こんにちは", "世界")
+	gitCommit(t, assets, "add Test")
+
+	srv.InjectFault(paratranztest.Fault{Method: http.MethodPost, Path: "/projects/1/files", Status: http.StatusTooManyRequests, RetryAfter: time.Second, Times: 1})
+	runCommand(t, srv, config, "sync")
+
+	f, has := srv.Files(1)["StoryData/Test.json"]
+	if !has {
+		t.Fatalf("file not created, have %v", srv.Files(1))
+	}
+	strs := stringsByKey(srv.Strings(1, f.ID))
+	if got := strs["dataList->1->content"]; got.Original != "세계" || !strings.Contains(got.Context, "World") || !strings.Contains(got.Context, "世界") {
+		t.Fatalf("created string %+v, want the KR original with EN and JP context", got)
+	}
+
+	// translate and review both contents
+	h := NewParatranzHandler(1, "test", WithAPIRoot(srv.APIRoot()))
+	tb, _ := json.Marshal([]ParatranzTranslation{
+		{Key: "dataList->0->content", Translation: "你好", Stage: stageReviewed},
+		{Key: "dataList->1->content", Translation: "世界", Stage: stageReviewed},
+	})
+	if err := h.UpdateTranslation(context.Background(), f.ID, tb, f.Name, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// update, every key moves by one
+	writeAsset(t, assets, "kr", "Test.json", "새로운", "안녕", "세계")
+	writeAsset(t, assets, "en", "Test.json", "New", "Hello", "World")
+	writeAsset(t, assets, "jp", "Test.json", "新しい", "こんにちは", "世界")
+	gitCommit(t, assets, "insert in Test")
+
+	srv.InjectFault(paratranztest.Fault{Method: http.MethodPost, Path: "/projects/1/files/" + strconv.Itoa(f.ID), Status: http.StatusBadGateway, Times: 1})
+	runCommand(t, srv, config, "sync")
+
+	strs = stringsByKey(srv.Strings(1, f.ID))
+	for key, want := range map[string]string{"dataList->1->content": "你好", "dataList->2->content": "世界"} {
+		if got := strs[key]; got.Translation != want || got.Stage != stageReviewed {
+			t.Errorf("%s = %q stage %d after the update, want %q reviewed", key, got.Translation, got.Stage, want)
+		}
+	}
+	if got := strs["dataList->0->content"]; got.Translation != "" || got.Stage != 0 {
+		t.Errorf("inserted string %+v, want it untranslated", got)
+	}
+
+	// export
+	os.MkdirAll(filepath.Join(dir, "dump"), os.ModePerm)
+	if err := os.WriteFile(filepath.Join(dir, "dump", "en_files.txt"), []byte("M\ten/StoryData/EN_Test.json\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	runCommand(t, srv, config, "export", "-lang", "en")
+
+	out, err := os.ReadFile(filepath.Join(dir, "export", "TW", "StoryData", "Test.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\xef\xbb\xbf{\n  \"dataList\": [\n" +
+		"    {\"id\": 1, \"model\": \"m1\", \"content\": \"New\"},\n" +
+		"    {\"id\": 2, \"model\": \"m2\", \"content\": \"你好\"},\n" +
+		"    {\"id\": 3, \"model\": \"m3\", \"content\": \"世界\"}\n" +
+		"  ]\n}\n"
+	if string(out) != want {
+		t.Errorf("export is\n%s\nwant\n%s", out, want)
+	}
+}
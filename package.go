@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	packageFolder  = ""
+	packageFont    = ""
+	packageVersion = ""
+	packageOut     = "export"
+)
+
+// cltLangRoot is where the game looks for custom languages.
+const cltLangRoot = "LimbusCompany_Data/Lang"
+
+// packageEntry is one file of a zip, read from src or held in data.
+type packageEntry struct {
+	path string
+	src  string
+	data []byte
+}
+
+func (e packageEntry) read() ([]byte, error) {
+	if e.src == "" {
+		return e.data, nil
+	}
+	return os.ReadFile(e.src)
+}
+
+type packageFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type packageArchive struct {
+	Name   string        `json:"name"`
+	Size   int64         `json:"size"`
+	SHA256 string        `json:"sha256"`
+	Files  []packageFile `json:"files"`
+}
+
+// packageTime is the modification time of every zip entry, SOURCE_DATE_EPOCH
+// when set, so the same export always gives the same zips.
+func packageTime() time.Time {
+	if v, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(v, 0).UTC()
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// buildPackages zips the export for release: CLT_only_text with the texts,
+// CLT_complete with the font and config.json added when there is a font,
+// and localize_files with the texts alone. manifest.json lists what went in.
+func buildPackages(ctx context.Context) error {
+	folder := packageFolder
+	if folder == "" {
+		folder = cfg.ExportFolder
+	}
+	if strings.ContainsAny(folder, `/\`) || folder == "." || folder == ".." {
+		return fmt.Errorf("%w: -folder %q must be a single folder name", errUsage, folder)
+	}
+
+	src := cfg.exportDir()
+	zap.S().Infow("Start package", "export", src, "folder", folder, "font", packageFont, "version", packageVersion)
+
+	texts := []packageEntry{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(src, p)
+		texts = append(texts, packageEntry{path: filepath.ToSlash(rel), src: p})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read export %s: %w", src, err)
+	}
+	if len(texts) == 0 {
+		return fmt.Errorf("nothing exported in %s", src)
+	}
+
+	clt := []packageEntry{}
+	for _, e := range texts {
+		clt = append(clt, packageEntry{path: path.Join(cltLangRoot, folder, e.path), src: e.src})
+	}
+
+	suffix := ""
+	if packageVersion != "" {
+		suffix = "_" + packageVersion
+	}
+
+	archives := map[string][]packageEntry{
+		"CLT_only_text" + suffix + ".zip": clt,
+		"localize_files.zip":              texts,
+	}
+
+	if packageFont != "" {
+		if _, err := os.Stat(packageFont); err != nil {
+			return fmt.Errorf("font: %w", err)
+		}
+
+		// only the complete package switches the game to the folder, the
+		// texts alone are meant to be dropped into an existing install
+		config, err := json.Marshal(struct {
+			Lang string `json:"lang"`
+		}{folder})
+		if err != nil {
+			return err
+		}
+		config = append(config, '\n')
+		if err := os.WriteFile(filepath.Join(cfg.ExportRoot, "config.json"), config, os.ModePerm); err != nil {
+			return fmt.Errorf("write config.json: %w", err)
+		}
+
+		ext := filepath.Ext(packageFont)
+		complete := append([]packageEntry{{path: path.Join(cltLangRoot, "config.json"), data: config}}, clt...)
+		for _, kind := range []string{"Context", "Title"} {
+			complete = append(complete, packageEntry{path: path.Join(cltLangRoot, folder, "Font", kind, kind+ext), src: packageFont})
+		}
+		archives["CLT_complete"+suffix+".zip"] = complete
+	}
+
+	os.MkdirAll(packageOut, os.ModePerm)
+
+	names := []string{}
+	for name := range archives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest := struct {
+		Version  string           `json:"version"`
+		Folder   string           `json:"folder"`
+		Font     string           `json:"font,omitempty"`
+		Archives []packageArchive `json:"archives"`
+	}{Version: packageVersion, Folder: folder}
+	if packageFont != "" {
+		manifest.Font = filepath.Base(packageFont)
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		a, err := writePackageZip(filepath.Join(packageOut, name), archives[name])
+		if err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+		a.Name = name
+		manifest.Archives = append(manifest.Archives, a)
+		zap.S().Infow("package written", "zip", name, "files", len(a.Files), "size", a.Size)
+	}
+
+	b, err := JSONMarshal(manifest)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal manifest: %w", err)
+	}
+	return os.WriteFile(filepath.Join(packageOut, "manifest.json"), b, os.ModePerm)
+}
+
+// writePackageZip writes the entries sorted by path with fixed times and
+// modes.
+func writePackageZip(p string, entries []packageEntry) (packageArchive, error) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	a := packageArchive{}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return a, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(f, hash))
+	modified := packageTime()
+
+	for _, e := range entries {
+		data, err := e.read()
+		if err != nil {
+			return a, err
+		}
+
+		hdr := &zip.FileHeader{Name: e.path, Method: zip.Deflate, Modified: modified}
+		hdr.SetMode(0o644)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return a, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return a, err
+		}
+
+		sum := sha256.Sum256(data)
+		a.Files = append(a.Files, packageFile{Path: e.path, Size: len(data), SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	if err := zw.Close(); err != nil {
+		return a, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return a, err
+	}
+	a.Size = info.Size()
+	a.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return a, f.Close()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func zipNames(t *testing.T, p string) []string {
+	t.Helper()
+
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestBuildPackages(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() { packageFolder, packageFont, packageVersion = "", "", "" }()
+
+	cfg = defaultConfig()
+	text := filepath.Join(cfg.exportDir(), "StoryData", "A.json")
+	os.MkdirAll(filepath.Dir(text), os.ModePerm)
+	os.WriteFile(text, []byte("{}"), os.ModePerm)
+	os.WriteFile("font.ttf", []byte("font"), os.ModePerm)
+
+	packageFolder, packageFont, packageVersion = "CN", "font.ttf", "v1"
+	ctx := context.Background()
+	if err := buildPackages(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"CLT_only_text_v1.zip": {
+			"LimbusCompany_Data/Lang/CN/StoryData/A.json",
+		},
+		"CLT_complete_v1.zip": {
+			"LimbusCompany_Data/Lang/CN/Font/Context/Context.ttf",
+			"LimbusCompany_Data/Lang/CN/Font/Title/Title.ttf",
+			"LimbusCompany_Data/Lang/CN/StoryData/A.json",
+			"LimbusCompany_Data/Lang/config.json",
+		},
+		"localize_files.zip": {"StoryData/A.json"},
+	}
+	for name, files := range want {
+		got := zipNames(t, filepath.Join(packageOut, name))
+		if len(got) != len(files) {
+			t.Errorf("%s holds %v, want %v", name, got, files)
+			continue
+		}
+		for i := range files {
+			if got[i] != files[i] {
+				t.Errorf("%s holds %v, want %v in order", name, got, files)
+				break
+			}
+		}
+	}
+
+	manifest := struct {
+		Archives []packageArchive `json:"archives"`
+	}{}
+	b, _ := os.ReadFile(filepath.Join(packageOut, "manifest.json"))
+	if err := json.Unmarshal(b, &manifest); err != nil || len(manifest.Archives) != 3 {
+		t.Fatalf("manifest %s, %v, want the 3 zips", b, err)
+	}
+
+	// the same export gives the same zips
+	if err := buildPackages(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(filepath.Join(packageOut, "manifest.json"))
+	again := struct {
+		Archives []packageArchive `json:"archives"`
+	}{}
+	json.Unmarshal(b, &again)
+	for i := range manifest.Archives {
+		if manifest.Archives[i].SHA256 != again.Archives[i].SHA256 {
+			t.Errorf("%s changed between two builds of the same export", manifest.Archives[i].Name)
+		}
+	}
+
+	packageFolder = "../CN"
+	if err := buildPackages(ctx); err == nil {
+		t.Error("folder outside Lang packaged, want an error")
+	}
+}
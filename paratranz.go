@@ -2,57 +2,174 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	paratranzAPIRoot   = "https://paratranz.cn/api"
-	ParatranzRetry     = "429 retry"
-	ParatranzEmptySkip = "empty"
+	paratranzAPIRoot = "https://paratranz.cn/api"
+
+	paratranzRequestTimeout = 5 * time.Minute
+	paratranzRateLimit      = 4
+	paratranzRateBurst      = 8
 )
 
-func NewParatranzHandler(id int, token string) *ParatranzHandler {
-	return &ParatranzHandler{id: id, token: token, client: &http.Client{}}
+// ParatranzOption customises a ParatranzHandler built by NewParatranzHandler.
+type ParatranzOption func(*ParatranzHandler)
+
+// WithAPIRoot points the handler at another ParaTranz compatible API, such as
+// a staging mirror or a local fake server.
+func WithAPIRoot(apiRoot string) ParatranzOption {
+	return func(h *ParatranzHandler) {
+		if apiRoot != "" {
+			h.apiRoot = apiRoot
+		}
+	}
+}
+
+// WithTransport replaces the HTTP transport used for every request.
+func WithTransport(rt http.RoundTripper) ParatranzOption {
+	return func(h *ParatranzHandler) {
+		h.client.Transport = rt
+	}
+}
+
+// WithRequestTimeout bounds every single request, zero keeps the default.
+func WithRequestTimeout(timeout time.Duration) ParatranzOption {
+	return func(h *ParatranzHandler) {
+		if timeout > 0 {
+			h.timeout = timeout
+		}
+	}
+}
+
+// WithRateLimit sets the requests per second and burst of the handler's
+// token bucket, a non-positive rate disables the limiter.
+func WithRateLimit(rate float64, burst int) ParatranzOption {
+	return func(h *ParatranzHandler) {
+		h.limiter = newRateLimiter(rate, burst)
+	}
+}
+
+// WithReadOnly makes every mutating request fail with ErrReadOnly before it
+// reaches the network.
+func WithReadOnly() ParatranzOption {
+	return func(h *ParatranzHandler) {
+		h.readOnly = true
+	}
+}
+
+func NewParatranzHandler(id int, token string, opts ...ParatranzOption) *ParatranzHandler {
+	h := &ParatranzHandler{
+		id:      id,
+		token:   token,
+		apiRoot: paratranzAPIRoot,
+		timeout: paratranzRequestTimeout,
+		limiter: newRateLimiter(paratranzRateLimit, paratranzRateBurst),
+		client:  &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 type ParatranzHandler struct {
-	id     int
-	token  string
-	client *http.Client
+	id       int
+	token    string
+	apiRoot  string
+	timeout  time.Duration
+	limiter  *rateLimiter
+	client   *http.Client
+	readOnly bool
+	snapshot *runSnapshot
 }
 
-func (h *ParatranzHandler) GetFiles() (map[string]ParatranzFile, error) {
-	urlpath, _ := url.JoinPath(paratranzAPIRoot, "projects", strconv.Itoa(h.id), "files")
+// do sends one request through the shared limiter and returns the body of a
+// 200 answer. Rate limit headers on any answer pause the limiter for every
+// caller of this handler.
+func (h *ParatranzHandler) do(ctx context.Context, name, method, urlpath string, body io.Reader, contentType string) ([]byte, error) {
+	if h.readOnly && method != "GET" {
+		return nil, fmt.Errorf("%s %s: %w", method, strings.TrimPrefix(urlpath, h.apiRoot), ErrReadOnly)
+	}
+
+	// time spent waiting for the limiter does not count against the request
+	if err := h.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", urlpath, nil)
+	req, err := http.NewRequestWithContext(ctx, method, urlpath, body)
 	if err != nil {
-		fmt.Println("GetFiles NewRequest fail", urlpath, err)
+		fmt.Println(name, "NewRequest fail", urlpath, err)
 		return nil, err
 	}
 	req.Header.Set("Authorization", h.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// the transport reports the write from its own goroutine
+	var sent atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) { sent.Store(info.Err == nil) },
+	}))
+
 	resp, err := h.client.Do(req)
 	if err != nil {
-		fmt.Println("GetFiles Request fail", urlpath, err)
+		fmt.Println(name, "Request fail", urlpath, err)
+		if !sent.Load() {
+			return nil, fmt.Errorf("%w: %w", errNotSent, err)
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Println("GetFiles Request fail", urlpath, resp.StatusCode, string(body))
-		return nil, fmt.Errorf("request StatusCode %d error: %s", resp.StatusCode, string(body))
+	wait := rateLimitWait(resp.Header, time.Now())
+	if wait > 0 {
+		h.limiter.Pause(wait)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println(name, "Read fail", urlpath, err)
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(respBody),
+			Endpoint:   method + " " + strings.TrimPrefix(urlpath, h.apiRoot),
+			RetryAfter: wait,
+		}
+	}
+
+	return respBody, nil
+}
+
+func (h *ParatranzHandler) GetFiles(ctx context.Context) (map[string]ParatranzFile, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "files")
+
+	body, err := h.do(ctx, "GetFiles", "GET", urlpath, nil, "")
+	if err != nil {
+		return nil, err
 	}
 
 	files := []ParatranzFile{}
-	err = json.NewDecoder(resp.Body).Decode(&files)
+	err = json.Unmarshal(body, &files)
 	if err != nil {
 		fmt.Println("GetFiles Decode fail", urlpath, err)
 		return nil, err
@@ -67,8 +184,8 @@ func (h *ParatranzHandler) GetFiles() (map[string]ParatranzFile, error) {
 	return m, nil
 }
 
-func (h *ParatranzHandler) UploadFile(data []byte, folder, name string) (*ParatranzFile, error) {
-	urlpath, _ := url.JoinPath(paratranzAPIRoot, "projects", strconv.Itoa(h.id), "files")
+func (h *ParatranzHandler) UploadFile(ctx context.Context, data []byte, folder, name string) (*ParatranzFile, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "files")
 
 	form := new(bytes.Buffer)
 	writer := multipart.NewWriter(form)
@@ -83,29 +200,9 @@ func (h *ParatranzHandler) UploadFile(data []byte, folder, name string) (*Paratr
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", urlpath, form)
-	if err != nil {
-		fmt.Println("UploadFile NewRequest fail", urlpath, err)
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", h.token)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := h.client.Do(req)
+	body, err := h.do(ctx, "UploadFile", "POST", urlpath, form, writer.FormDataContentType())
 	if err != nil {
-		fmt.Println("UploadFile Request fail", urlpath, err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode == 429 {
-		return nil, errors.New(ParatranzRetry)
-	}
-
-	if resp.StatusCode != 200 {
-		fmt.Println("UploadFile Request fail", urlpath, resp.StatusCode, string(body))
-		return nil, fmt.Errorf("request StatusCode %d error: %s", resp.StatusCode, string(body))
+		return nil, onceSent(err)
 	}
 
 	respfile := struct {
@@ -116,48 +213,39 @@ func (h *ParatranzHandler) UploadFile(data []byte, folder, name string) (*Paratr
 
 	err = json.Unmarshal(body, &respfile)
 	if err != nil {
-		fmt.Println("GetFiles Decode fail", urlpath, err)
+		fmt.Println("UploadFile Decode fail", urlpath, err)
 		return nil, err
 	}
 
-	if respfile.Status == ParatranzEmptySkip {
-		return nil, errors.New(ParatranzEmptySkip)
+	if respfile.Status == paratranzStatusEmpty {
+		return nil, ErrEmptyFile
+	}
+
+	// the file exists now, failing here would only upload it twice
+	if err := h.recordUpload(respfile.File); err != nil {
+		fmt.Println("UploadFile record fail", urlpath, err)
 	}
 
 	return &respfile.File, nil
 }
 
-func (h *ParatranzHandler) DeleteFile(id int) error {
-	urlpath, _ := url.JoinPath(paratranzAPIRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id))
-
-	req, err := http.NewRequest("DELETE", urlpath, nil)
-	if err != nil {
-		fmt.Println("GetFiles NewRequest fail", urlpath, err)
+func (h *ParatranzHandler) DeleteFile(ctx context.Context, id int) error {
+	if err := h.snapshotFile(ctx, id); err != nil {
 		return err
 	}
-	req.Header.Set("Authorization", h.token)
-	resp, err := h.client.Do(req)
-	if err != nil {
-		fmt.Println("GetFiles Request fail", urlpath, err)
-		return err
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == 429 {
-		return errors.New(ParatranzRetry)
-	}
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Println("DeleteFile Request fail", urlpath, resp.StatusCode, string(body))
-		return fmt.Errorf("request StatusCode %d error: %s", resp.StatusCode, string(body))
-	}
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id))
 
-	return nil
+	_, err := h.do(ctx, "DeleteFile", "DELETE", urlpath, nil, "")
+	return err
 }
 
-func (h *ParatranzHandler) UpdateFile(id int, data []byte, folder, name string, isRawFormat bool) error {
-	urlpath, _ := url.JoinPath(paratranzAPIRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id))
+func (h *ParatranzHandler) UpdateFile(ctx context.Context, id int, data []byte, folder, name string, isRawFormat bool) error {
+	if err := h.snapshotFile(ctx, id); err != nil {
+		return err
+	}
+
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id))
 
 	form := new(bytes.Buffer)
 	writer := multipart.NewWriter(form)
@@ -173,58 +261,29 @@ func (h *ParatranzHandler) UpdateFile(id int, data []byte, folder, name string,
 		return err
 	}
 
-	req, err := http.NewRequest("POST", urlpath, form)
+	body, err := h.do(ctx, "UpdateFile", "POST", urlpath, form, writer.FormDataContentType())
 	if err != nil {
-		fmt.Println("UploadFile NewRequest fail", urlpath, err)
 		return err
 	}
 
-	req.Header.Set("Authorization", h.token)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := h.client.Do(req)
-	if err != nil {
-		fmt.Println("UploadFile Request fail", urlpath, err)
-		return err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode == 429 {
-		return errors.New(ParatranzRetry)
-	}
+	respfile := struct {
+		Status string `json:"status"`
+	}{}
 
-	if resp.StatusCode != 200 {
-		fmt.Println("UploadFile Request fail", urlpath, resp.StatusCode, string(body))
-		return fmt.Errorf("request StatusCode %d error: %s", resp.StatusCode, string(body))
+	// older answers carry no body worth decoding, only an empty status matters
+	if json.Unmarshal(body, &respfile) == nil && respfile.Status == paratranzStatusEmpty {
+		return ErrEmptyFile
 	}
 	return nil
 }
 
-func (h *ParatranzHandler) GetTranslation(id int) ([]ParatranzTranslation, error) {
-	urlpath, _ := url.JoinPath(paratranzAPIRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id), "translation")
+func (h *ParatranzHandler) GetTranslation(ctx context.Context, id int) ([]ParatranzTranslation, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id), "translation")
 
-	req, err := http.NewRequest("GET", urlpath, nil)
+	body, err := h.do(ctx, "GetTranslation", "GET", urlpath, nil, "")
 	if err != nil {
-		fmt.Println("GetTranslation NewRequest fail", urlpath, err)
 		return nil, err
 	}
-	req.Header.Set("Authorization", h.token)
-	resp, err := h.client.Do(req)
-	if err != nil {
-		fmt.Println("GetTranslation Request fail", urlpath, err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 429 {
-		return nil, errors.New(ParatranzRetry)
-	}
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		fmt.Println("GetTranslation Request fail", urlpath, resp.StatusCode, string(body))
-		return nil, fmt.Errorf("request StatusCode %d error: %s", resp.StatusCode, string(body))
-	}
 
 	trans := []ParatranzTranslation{}
 	err = json.Unmarshal(body, &trans)
@@ -236,8 +295,12 @@ func (h *ParatranzHandler) GetTranslation(id int) ([]ParatranzTranslation, error
 	return trans, nil
 }
 
-func (h *ParatranzHandler) UpdateTranslation(id int, data []byte, name string, isRawFormat, isForce bool) error {
-	urlpath, _ := url.JoinPath(paratranzAPIRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id), "translation")
+func (h *ParatranzHandler) UpdateTranslation(ctx context.Context, id int, data []byte, name string, isRawFormat, isForce bool) error {
+	if err := h.snapshotFile(ctx, id); err != nil {
+		return err
+	}
+
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "files", strconv.Itoa(id), "translation")
 
 	form := new(bytes.Buffer)
 	writer := multipart.NewWriter(form)
@@ -255,32 +318,180 @@ func (h *ParatranzHandler) UpdateTranslation(id int, data []byte, name string, i
 		return err
 	}
 
-	req, err := http.NewRequest("POST", urlpath, form)
+	_, err = h.do(ctx, "UpdateTranslation", "POST", urlpath, form, writer.FormDataContentType())
+	return err
+}
+
+func (h *ParatranzHandler) CreateString(ctx context.Context, str ParatranzString) (*ParatranzTranslation, error) {
+	if str.File != nil {
+		if err := h.snapshotFile(ctx, *str.File); err != nil {
+			return nil, err
+		}
+	}
+
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "strings")
+
+	data, err := json.Marshal(str)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := h.do(ctx, "CreateString", "POST", urlpath, bytes.NewReader(data), "application/json")
+	if err != nil {
+		return nil, onceSent(err)
+	}
+
+	tran := ParatranzTranslation{}
+	err = json.Unmarshal(body, &tran)
 	if err != nil {
-		fmt.Println("UploadFile NewRequest fail", urlpath, err)
+		fmt.Println("CreateString Decode fail", urlpath, err)
+		return nil, err
+	}
+
+	return &tran, nil
+}
+
+// UpdateString changes the fields of str that are set, the others are kept.
+// file is the id of the file holding the string.
+func (h *ParatranzHandler) UpdateString(ctx context.Context, file, id int, str ParatranzString) error {
+	if err := h.snapshotFile(ctx, file); err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", h.token)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := h.client.Do(req)
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "strings", strconv.Itoa(id))
+
+	data, err := json.Marshal(str)
 	if err != nil {
-		fmt.Println("UploadFile Request fail", urlpath, err)
 		return err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
 
-	if resp.StatusCode == 429 {
-		return errors.New(ParatranzRetry)
+	_, err = h.do(ctx, "UpdateString", "PUT", urlpath, bytes.NewReader(data), "application/json")
+	return err
+}
+
+// DeleteString removes a string of the file with the id file.
+func (h *ParatranzHandler) DeleteString(ctx context.Context, file, id int) error {
+	if err := h.snapshotFile(ctx, file); err != nil {
+		return err
+	}
+
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "strings", strconv.Itoa(id))
+
+	_, err := h.do(ctx, "DeleteString", "DELETE", urlpath, nil, "")
+	return err
+}
+
+// termsPageSize is how many terms GetTerms asks for per page.
+const termsPageSize = 500
+
+// GetTerms returns every term of the project glossary, page by page.
+func (h *ParatranzHandler) GetTerms(ctx context.Context) ([]ParatranzTerm, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "terms")
+
+	terms := []ParatranzTerm{}
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("page", strconv.Itoa(page))
+		q.Set("pageSize", strconv.Itoa(termsPageSize))
+
+		body, err := h.do(ctx, "GetTerms", "GET", urlpath+"?"+q.Encode(), nil, "")
+		if err != nil {
+			return nil, err
+		}
+
+		resp := struct {
+			Page      int             `json:"page"`
+			PageCount int             `json:"pageCount"`
+			Results   []ParatranzTerm `json:"results"`
+		}{}
+		err = json.Unmarshal(body, &resp)
+		if err != nil {
+			fmt.Println("GetTerms Decode fail", urlpath, err)
+			return nil, err
+		}
+
+		terms = append(terms, resp.Results...)
+		if page >= resp.PageCount || len(resp.Results) == 0 {
+			return terms, nil
+		}
 	}
+}
+
+func (h *ParatranzHandler) CreateTerm(ctx context.Context, term ParatranzTerm) (*ParatranzTerm, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "terms")
 
-	if resp.StatusCode != 200 {
-		fmt.Println("UploadFile Request fail", urlpath, resp.StatusCode, string(body))
-		return fmt.Errorf("request StatusCode %d error: %s", resp.StatusCode, string(body))
+	data, err := json.Marshal(term)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	body, err := h.do(ctx, "CreateTerm", "POST", urlpath, bytes.NewReader(data), "application/json")
+	if err != nil {
+		return nil, onceSent(err)
+	}
+
+	created := ParatranzTerm{}
+	err = json.Unmarshal(body, &created)
+	if err != nil {
+		fmt.Println("CreateTerm Decode fail", urlpath, err)
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (h *ParatranzHandler) UpdateTerm(ctx context.Context, id int, term ParatranzTerm) error {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "terms", strconv.Itoa(id))
+
+	data, err := json.Marshal(term)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.do(ctx, "UpdateTerm", "PUT", urlpath, bytes.NewReader(data), "application/json")
+	return err
+}
+
+func (h *ParatranzHandler) DeleteTerm(ctx context.Context, id int) error {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "terms", strconv.Itoa(id))
+
+	_, err := h.do(ctx, "DeleteTerm", "DELETE", urlpath, nil, "")
+	return err
+}
+
+// GetArtifact returns the state of the last generated artifact.
+func (h *ParatranzHandler) GetArtifact(ctx context.Context) (*ParatranzArtifact, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "artifacts")
+
+	body, err := h.do(ctx, "GetArtifact", "GET", urlpath, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := ParatranzArtifact{}
+	err = json.Unmarshal(body, &artifact)
+	if err != nil {
+		fmt.Println("GetArtifact Decode fail", urlpath, err)
+		return nil, err
+	}
+
+	return &artifact, nil
+}
+
+// TriggerArtifact asks paratranz to generate a new artifact, it is ready
+// once GetArtifact reports a newer CreatedAt.
+func (h *ParatranzHandler) TriggerArtifact(ctx context.Context) error {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "artifacts")
+
+	_, err := h.do(ctx, "TriggerArtifact", "POST", urlpath, nil, "")
+	return onceSent(err)
+}
+
+// DownloadArtifact returns the zip of the last generated artifact.
+func (h *ParatranzHandler) DownloadArtifact(ctx context.Context) ([]byte, error) {
+	urlpath, _ := url.JoinPath(h.apiRoot, "projects", strconv.Itoa(h.id), "artifacts", "download")
+
+	return h.do(ctx, "DownloadArtifact", "GET", urlpath, nil, "")
 }
 
 type ParatranzFile struct {
@@ -303,6 +514,17 @@ type ParatranzFile struct {
 	Folder     string    `json:"folder"`
 }
 
+// stages of a paratranz string
+const (
+	stageHidden       = -1
+	stageUntranslated = 0
+	stageTranslated   = 1
+	stageDisputed     = 2
+	stageChecked      = 3
+	stageReviewed     = 5
+	stageLocked       = 9
+)
+
 type ParatranzTranslation struct {
 	ID          int    `json:"id"`
 	Key         string `json:"key"`
@@ -315,8 +537,31 @@ type ParatranzTranslation struct {
 type ParatranzString struct {
 	ID          *int    `json:"id,omitempty"`
 	Key         string  `json:"key"`
+	File        *int    `json:"file,omitempty"`
 	Original    *string `json:"original,omitempty"`
 	Translation *string `json:"translation,omitempty"`
 	Stage       *int    `json:"stage,omitempty"`
 	Context     *string `json:"context,omitempty"`
 }
+
+type ParatranzTerm struct {
+	ID            int      `json:"id,omitempty"`
+	Term          string   `json:"term"`
+	Translation   string   `json:"translation"`
+	Pos           string   `json:"pos,omitempty"`
+	Note          string   `json:"note"`
+	Variants      []string `json:"variants,omitempty"`
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+}
+
+type ParatranzArtifact struct {
+	ID         int       `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Project    int       `json:"project"`
+	Total      int       `json:"total"`
+	Translated int       `json:"translated"`
+	Disputed   int       `json:"disputed"`
+	Reviewed   int       `json:"reviewed"`
+	Hidden     int       `json:"hidden"`
+	Duration   float64   `json:"duration"`
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// stalled never answers, like a paratranz connection that hangs.
+var stalled = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+})
+
+func TestHandlerRequestTimeout(t *testing.T) {
+	h := NewParatranzHandler(1, "token", WithRequestTimeout(20*time.Millisecond), WithTransport(stalled))
+
+	start := time.Now()
+	_, err := h.GetFiles(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetFiles error = %v, want the request deadline", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("GetFiles took %v with a 20ms request timeout", d)
+	}
+}
+
+func TestHandlerCancel(t *testing.T) {
+	h := NewParatranzHandler(1, "token", WithTransport(stalled))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := h.GetTranslation(ctx, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetTranslation error = %v, want the run cancellation", err)
+	}
+}
+
+func TestHandlerAPIRoot(t *testing.T) {
+	var got string
+	h := NewParatranzHandler(7, "token", WithAPIRoot("http://fake/api"), WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r.URL.String()
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("[]")), Header: http.Header{}}, nil
+	})))
+
+	if _, err := h.GetFiles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://fake/api/projects/7/files" {
+		t.Errorf("GetFiles requested %s, want the fake api root", got)
+	}
+}
+
+func TestRetryWithBackoffStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	calls := 0
+	start := time.Now()
+	err := retryWithBackoff(ctx, func() error {
+		calls++
+		return &APIError{StatusCode: http.StatusTooManyRequests}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("retryWithBackoff error = %v, want the cancellation", err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("retryWithBackoff called fn %d times in %v, want one call and a prompt stop", calls, time.Since(start))
+	}
+}
@@ -0,0 +1,910 @@
+// Package paratranztest provides an in-memory fake of the ParaTranz API for
+// exercising the uploader without a token or network access.
+//
+//	srv := paratranztest.NewServer()
+//	defer srv.Close()
+//	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()))
+package paratranztest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type String struct {
+	ID          int    `json:"id"`
+	Key         string `json:"key"`
+	Original    string `json:"original"`
+	Translation string `json:"translation"`
+	Stage       int    `json:"stage"`
+	Context     string `json:"context,omitempty"`
+}
+
+type File struct {
+	ID         int       `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	Name       string    `json:"name"`
+	Project    int       `json:"project"`
+	Format     string    `json:"format"`
+	Total      int       `json:"total"`
+	Translated int       `json:"translated"`
+	Disputed   int       `json:"disputed"`
+	Checked    int       `json:"checked"`
+	Reviewed   int       `json:"reviewed"`
+	Hidden     int       `json:"hidden"`
+	Locked     int       `json:"locked"`
+	Words      int       `json:"words"`
+	Hash       string    `json:"hash"`
+	Folder     string    `json:"folder"`
+
+	strings []String
+}
+
+type Term struct {
+	ID            int      `json:"id"`
+	Term          string   `json:"term"`
+	Translation   string   `json:"translation"`
+	Pos           string   `json:"pos,omitempty"`
+	Note          string   `json:"note"`
+	Variants      []string `json:"variants,omitempty"`
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+}
+
+// Fault makes matching requests fail with Status instead of being served.
+// Path matches as a prefix of the request path below /api, an empty Method
+// or Path matches everything. Times limits how often the fault fires, zero
+// means every matching request.
+type Fault struct {
+	Method     string
+	Path       string
+	Status     int
+	Body       string
+	RetryAfter time.Duration
+	Times      int
+}
+
+type Server struct {
+	*httptest.Server
+
+	// Token, when set, is required in the Authorization header.
+	Token string
+
+	mu           sync.Mutex
+	files        map[int]map[int]*File
+	nextFileID   int
+	nextStringID int
+	terms        map[int][]Term
+	nextTermID   int
+	artifacts    map[int]time.Time
+	faults       []*Fault
+	requests     []string
+}
+
+func NewServer() *Server {
+	s := &Server{files: map[int]map[int]*File{}, terms: map[int][]Term{}, artifacts: map[int]time.Time{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/projects/{project}/files", s.getFiles)
+	mux.HandleFunc("POST /api/projects/{project}/files", s.uploadFile)
+	mux.HandleFunc("POST /api/projects/{project}/files/{file}", s.updateFile)
+	mux.HandleFunc("DELETE /api/projects/{project}/files/{file}", s.deleteFile)
+	mux.HandleFunc("GET /api/projects/{project}/files/{file}/translation", s.getTranslation)
+	mux.HandleFunc("POST /api/projects/{project}/files/{file}/translation", s.updateTranslation)
+	mux.HandleFunc("POST /api/projects/{project}/strings", s.createString)
+	mux.HandleFunc("PUT /api/projects/{project}/strings/{string}", s.updateString)
+	mux.HandleFunc("DELETE /api/projects/{project}/strings/{string}", s.deleteString)
+	mux.HandleFunc("GET /api/projects/{project}/terms", s.getTerms)
+	mux.HandleFunc("POST /api/projects/{project}/terms", s.createTerm)
+	mux.HandleFunc("PUT /api/projects/{project}/terms/{term}", s.updateTerm)
+	mux.HandleFunc("DELETE /api/projects/{project}/terms/{term}", s.deleteTerm)
+	mux.HandleFunc("GET /api/projects/{project}/artifacts", s.getArtifact)
+	mux.HandleFunc("POST /api/projects/{project}/artifacts", s.triggerArtifact)
+	mux.HandleFunc("GET /api/projects/{project}/artifacts/download", s.downloadArtifact)
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// APIRoot is the base url to hand to the uploader.
+func (s *Server) APIRoot() string {
+	return s.URL + "/api"
+}
+
+// AddFile seeds a file in project and returns its id.
+func (s *Server) AddFile(project int, name string, strs []String) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.newFile(project, name)
+	f.strings = s.assignIDs(strs)
+	return f.ID
+}
+
+// Files returns a copy of every file in project keyed by name.
+func (s *Server) Files(project int) map[string]File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := map[string]File{}
+	for _, f := range s.files[project] {
+		m[f.Name] = s.snapshot(f)
+	}
+	return m
+}
+
+// Strings returns a copy of the strings of a file, nil if it does not exist.
+func (s *Server) Strings(project, file int) []String {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, has := s.files[project][file]
+	if !has {
+		return nil
+	}
+	return append([]String(nil), f.strings...)
+}
+
+// AddTerm seeds a glossary term in project and returns its id.
+func (s *Server) AddTerm(project int, t Term) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextTermID++
+	t.ID = s.nextTermID
+	s.terms[project] = append(s.terms[project], t)
+	return t.ID
+}
+
+// Terms returns a copy of the glossary of project.
+func (s *Server) Terms(project int) []Term {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Term(nil), s.terms[project]...)
+}
+
+// SetArtifact records an artifact of project generated at createdAt. The
+// download always holds the current strings.
+func (s *Server) SetArtifact(project int, createdAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.artifacts[project] = createdAt
+}
+
+// InjectFault queues a fault, faults are checked in the order they were added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// Requests lists every request seen so far as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		fault := s.matchFault(r)
+		s.mu.Unlock()
+
+		if s.Token != "" && r.Header.Get("Authorization") != s.Token {
+			http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if fault != nil {
+			if fault.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+			}
+			http.Error(w, fault.Body, fault.Status)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) matchFault(r *http.Request) *Fault {
+	p := strings.TrimPrefix(r.URL.Path, "/api")
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(p, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) getFiles(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	files := []File{}
+	for _, f := range s.files[project] {
+		files = append(files, s.snapshot(f))
+	}
+	s.mu.Unlock()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	writeJSON(w, files)
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	data, filename, err := readFormFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	strs, err := parseStrings(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(strs) == 0 {
+		writeJSON(w, map[string]any{"status": "empty"})
+		return
+	}
+
+	name := filename
+	if folder := r.FormValue("path"); folder != "" {
+		name = path.Join(folder, filename)
+	}
+
+	s.mu.Lock()
+	for _, f := range s.files[project] {
+		if f.Name == name {
+			s.mu.Unlock()
+			http.Error(w, `{"message":"file exists"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	f := s.newFile(project, name)
+	f.strings = s.assignIDs(strs)
+	resp := s.snapshot(f)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"file": resp, "status": "created"})
+}
+
+func (s *Server) updateFile(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.lookupFile(w, r)
+	if !ok {
+		return
+	}
+
+	data, _, err := readFormFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	strs, err := parseStrings(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := map[string]String{}
+	for _, str := range f.strings {
+		old[str.Key] = str
+	}
+
+	// keep translations of unchanged originals, like paratranz does
+	for i, str := range strs {
+		prev, has := old[str.Key]
+		if !has {
+			continue
+		}
+		strs[i].ID = prev.ID
+		if str.Context == "" {
+			strs[i].Context = prev.Context
+		}
+		if prev.Original == str.Original {
+			strs[i].Translation = prev.Translation
+			strs[i].Stage = prev.Stage
+		} else {
+			strs[i].Translation = ""
+			strs[i].Stage = 0
+		}
+	}
+
+	f.strings = s.assignIDs(strs)
+	f.UpdatedAt = time.Now()
+	f.ModifiedAt = f.UpdatedAt
+
+	writeJSON(w, map[string]any{"file": s.snapshot(f), "status": "updated"})
+}
+
+func (s *Server) deleteFile(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.lookupFile(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.files[f.Project], f.ID)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{})
+}
+
+func (s *Server) getTranslation(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.lookupFile(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	strs := append([]String{}, f.strings...)
+	s.mu.Unlock()
+
+	writeJSON(w, strs)
+}
+
+func (s *Server) updateTranslation(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.lookupFile(w, r)
+	if !ok {
+		return
+	}
+
+	data, _, err := readFormFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imports := []String{}
+	if err := json.Unmarshal(data, &imports); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	force := r.FormValue("force") == "true"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := map[string]int{}
+	for i, str := range f.strings {
+		index[str.Key] = i
+	}
+
+	for _, imp := range imports {
+		i, has := index[imp.Key]
+		if !has {
+			continue
+		}
+		cur := &f.strings[i]
+		if !force && cur.Stage != 0 {
+			continue
+		}
+		cur.Translation = imp.Translation
+		cur.Stage = imp.Stage
+		if cur.Stage == 0 && cur.Translation != "" {
+			cur.Stage = 1
+		}
+	}
+	f.UpdatedAt = time.Now()
+
+	writeJSON(w, map[string]any{})
+}
+
+func (s *Server) createString(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	req := struct {
+		String
+		File int `json:"file"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+		http.Error(w, `{"message":"bad string"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, has := s.files[project][req.File]
+	if !has {
+		http.Error(w, `{"message":"file not found"}`, http.StatusNotFound)
+		return
+	}
+	for _, str := range f.strings {
+		if str.Key == req.Key {
+			http.Error(w, `{"message":"key exists"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	req.String.ID = 0
+	str := s.assignIDs([]String{req.String})[0]
+	f.strings = append(f.strings, str)
+	f.UpdatedAt = time.Now()
+
+	writeJSON(w, str)
+}
+
+func (s *Server) updateString(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+	id, ok := pathInt(w, r, "string")
+	if !ok {
+		return
+	}
+
+	req := struct {
+		Original    *string `json:"original"`
+		Translation *string `json:"translation"`
+		Stage       *int    `json:"stage"`
+		Context     *string `json:"context"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message":"bad string"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, i := s.findString(project, id)
+	if f == nil {
+		http.Error(w, `{"message":"string not found"}`, http.StatusNotFound)
+		return
+	}
+
+	cur := &f.strings[i]
+	if req.Original != nil {
+		cur.Original = *req.Original
+	}
+	if req.Translation != nil {
+		cur.Translation = *req.Translation
+	}
+	if req.Stage != nil {
+		cur.Stage = *req.Stage
+	}
+	if req.Context != nil {
+		cur.Context = *req.Context
+	}
+	f.UpdatedAt = time.Now()
+
+	writeJSON(w, *cur)
+}
+
+func (s *Server) deleteString(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+	id, ok := pathInt(w, r, "string")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, i := s.findString(project, id)
+	if f == nil {
+		http.Error(w, `{"message":"string not found"}`, http.StatusNotFound)
+		return
+	}
+	f.strings = append(f.strings[:i], f.strings[i+1:]...)
+	f.UpdatedAt = time.Now()
+
+	writeJSON(w, map[string]any{})
+}
+
+// findString locates a string by id, the caller holds s.mu.
+func (s *Server) findString(project, id int) (*File, int) {
+	for _, f := range s.files[project] {
+		for i, str := range f.strings {
+			if str.ID == id {
+				return f, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// getTerms pages like paratranz, page and pageSize default to 1 and 50.
+func (s *Server) getTerms(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	page, size := 1, 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("pageSize")); err == nil && v > 0 {
+		size = v
+	}
+
+	s.mu.Lock()
+	terms := s.terms[project]
+	start := min((page-1)*size, len(terms))
+	end := min(start+size, len(terms))
+	results := append([]Term{}, terms[start:end]...)
+	count := len(terms)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{
+		"page":      page,
+		"pageSize":  size,
+		"pageCount": (count + size - 1) / size,
+		"rowCount":  count,
+		"results":   results,
+	})
+}
+
+func (s *Server) createTerm(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	t := Term{}
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.Term == "" {
+		http.Error(w, `{"message":"bad term"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cur := range s.terms[project] {
+		if cur.Term == t.Term {
+			http.Error(w, `{"message":"term exists"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	s.nextTermID++
+	t.ID = s.nextTermID
+	s.terms[project] = append(s.terms[project], t)
+
+	writeJSON(w, t)
+}
+
+func (s *Server) updateTerm(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+	id, ok := pathInt(w, r, "term")
+	if !ok {
+		return
+	}
+
+	t := Term{}
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.Term == "" {
+		http.Error(w, `{"message":"bad term"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, cur := range s.terms[project] {
+		if cur.ID == id {
+			t.ID = id
+			s.terms[project][i] = t
+			writeJSON(w, t)
+			return
+		}
+	}
+	http.Error(w, `{"message":"term not found"}`, http.StatusNotFound)
+}
+
+func (s *Server) deleteTerm(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+	id, ok := pathInt(w, r, "term")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, cur := range s.terms[project] {
+		if cur.ID == id {
+			s.terms[project] = append(s.terms[project][:i], s.terms[project][i+1:]...)
+			writeJSON(w, map[string]any{})
+			return
+		}
+	}
+	http.Error(w, `{"message":"term not found"}`, http.StatusNotFound)
+}
+
+func (s *Server) getArtifact(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	createdAt, has := s.artifacts[project]
+	s.mu.Unlock()
+
+	if !has {
+		http.Error(w, `{"message":"artifact not found"}`, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]any{"id": project, "project": project, "createdAt": createdAt})
+}
+
+// triggerArtifact generates the artifact right away.
+func (s *Server) triggerArtifact(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.artifacts[project] = time.Now()
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{})
+}
+
+func (s *Server) downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	files := []*File{}
+	for _, f := range s.files[project] {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		for _, root := range []string{"raw", "utf8"} {
+			fw, err := zw.Create(path.Join(root, f.Name+".json"))
+			if err == nil {
+				err = json.NewEncoder(fw).Encode(f.strings)
+			}
+			if err != nil {
+				s.mu.Unlock()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if err := zw.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) lookupFile(w http.ResponseWriter, r *http.Request) (*File, bool) {
+	project, ok := pathInt(w, r, "project")
+	if !ok {
+		return nil, false
+	}
+	id, ok := pathInt(w, r, "file")
+	if !ok {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	f, has := s.files[project][id]
+	s.mu.Unlock()
+
+	if !has {
+		http.Error(w, `{"message":"file not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return f, true
+}
+
+func (s *Server) newFile(project int, name string) *File {
+	s.nextFileID++
+	now := time.Now()
+	folder := path.Dir(name)
+	if folder == "." {
+		folder = ""
+	}
+	f := &File{
+		ID:         s.nextFileID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ModifiedAt: now,
+		Name:       name,
+		Project:    project,
+		Format:     "json",
+		Folder:     folder,
+	}
+	if s.files[project] == nil {
+		s.files[project] = map[int]*File{}
+	}
+	s.files[project][f.ID] = f
+	return f
+}
+
+func (s *Server) assignIDs(strs []String) []String {
+	out := make([]String, len(strs))
+	for i, str := range strs {
+		if str.ID == 0 {
+			s.nextStringID++
+			str.ID = s.nextStringID
+		}
+		out[i] = str
+	}
+	return out
+}
+
+func (s *Server) snapshot(f *File) File {
+	c := *f
+	c.strings = nil
+	c.Total, c.Translated, c.Disputed, c.Checked, c.Reviewed, c.Hidden, c.Locked, c.Words = 0, 0, 0, 0, 0, 0, 0, 0
+	for _, str := range f.strings {
+		c.Total++
+		c.Words += len(strings.Fields(str.Original))
+		switch {
+		case str.Stage == -1:
+			c.Hidden++
+		case str.Stage == 2:
+			c.Disputed++
+		case str.Stage == 9:
+			c.Locked++
+		}
+		if str.Stage >= 1 {
+			c.Translated++
+		}
+		if str.Stage >= 3 {
+			c.Checked++
+		}
+		if str.Stage >= 5 {
+			c.Reviewed++
+		}
+	}
+	return c
+}
+
+// parseStrings reads either paratranz's own key/original list or an
+// arbitrary JSON document whose string values become keyed strings.
+func parseStrings(data []byte) ([]String, error) {
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	list := []String{}
+	if err := json.Unmarshal(data, &list); err == nil {
+		out := []String{}
+		for _, str := range list {
+			if str.Key != "" {
+				str.ID = 0
+				out = append(out, str)
+			}
+		}
+		return out, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	out := []String{}
+	if err := flatten(dec, nil, &out); err != nil {
+		return nil, fmt.Errorf("parse json: %w", err)
+	}
+	return out, nil
+}
+
+// flatten walks the token stream so keys keep document order.
+func flatten(dec *json.Decoder, keys []string, out *[]String) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := flatten(dec, append(keys, kt.(string)), out); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err := flatten(dec, append(keys, strconv.Itoa(i)), out); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := dec.Token()
+		return err
+	case string:
+		*out = append(*out, String{Key: strings.Join(keys, "->"), Original: v})
+	}
+	return nil
+}
+
+func readFormFile(r *http.Request) ([]byte, string, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, "", err
+	}
+	fh, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	defer fh.Close()
+
+	data, err := io.ReadAll(fh)
+	return data, header.Filename, err
+}
+
+func pathInt(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	v, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"message":"bad %s"}`, name), http.StatusBadRequest)
+		return 0, false
+	}
+	return v, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
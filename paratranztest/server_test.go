@@ -0,0 +1,298 @@
+package paratranztest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, url, name string, data []byte, fields map[string]string) *http.Response {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	fw, _ := w.CreateFormFile("file", name)
+	fw.Write(data)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	w.Close()
+
+	resp, err := http.Post(url, w.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestUploadFlattensDocument(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	resp := post(t, srv.APIRoot()+"/projects/1/files", "Test.json",
+		[]byte("\xef\xbb\xbf{\"dataList\": [{\"id\": \"1\", \"content\": \"a\"}, {\"id\": \"2\", \"content\": \"b\"}]}"),
+		map[string]string{"path": "StoryData"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload status %d", resp.StatusCode)
+	}
+
+	f, has := srv.Files(1)["StoryData/Test.json"]
+	if !has || f.Total != 4 || f.Folder != "StoryData" {
+		t.Fatalf("uploaded file %+v, want 4 strings in StoryData", f)
+	}
+	strs := srv.Strings(1, f.ID)
+	want := []string{"dataList->0->id", "dataList->0->content", "dataList->1->id", "dataList->1->content"}
+	for i, key := range want {
+		if strs[i].Key != key {
+			t.Errorf("string %d key %q, want %q in document order", i, strs[i].Key, key)
+		}
+	}
+
+	resp = post(t, srv.APIRoot()+"/projects/1/files", "Test.json", []byte(`{"a": "b"}`), map[string]string{"path": "StoryData"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("second upload of the same name status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestUpdateKeepsUnchangedTranslations(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	id := srv.AddFile(1, "Test.json", []String{
+		{Key: "a", Original: "same", Translation: "kept", Stage: 5},
+		{Key: "b", Original: "old", Translation: "dropped", Stage: 1},
+	})
+
+	resp := post(t, srv.APIRoot()+"/projects/1/files/"+strconv.Itoa(id), "Test.json", []byte(`{"a": "same", "b": "new", "c": "added"}`), nil)
+	resp.Body.Close()
+
+	strs := srv.Strings(1, id)
+	if len(strs) != 3 {
+		t.Fatalf("got %d strings, want 3", len(strs))
+	}
+	if strs[0].Translation != "kept" || strs[0].Stage != 5 {
+		t.Errorf("unchanged string %+v, want its translation and stage", strs[0])
+	}
+	if strs[1].Translation != "" || strs[1].Stage != 0 {
+		t.Errorf("changed string %+v, want it untranslated", strs[1])
+	}
+}
+
+func TestUpdateTranslationForce(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	id := srv.AddFile(1, "Test.json", []String{
+		{Key: "a", Original: "x", Translation: "reviewed", Stage: 5},
+		{Key: "b", Original: "y"},
+	})
+	data := []byte(`[{"key": "a", "translation": "new a"}, {"key": "b", "translation": "new b"}]`)
+	url := srv.APIRoot() + "/projects/1/files/" + strconv.Itoa(id) + "/translation"
+
+	resp := post(t, url, "Test.json", data, nil)
+	resp.Body.Close()
+	strs := srv.Strings(1, id)
+	if strs[0].Translation != "reviewed" || strs[1].Translation != "new b" || strs[1].Stage != 1 {
+		t.Fatalf("without force got %+v, want only the untranslated string set", strs)
+	}
+
+	resp = post(t, url, "Test.json", data, map[string]string{"force": "true"})
+	resp.Body.Close()
+	if strs := srv.Strings(1, id); strs[0].Translation != "new a" {
+		t.Errorf("with force got %+v, want the reviewed string overwritten", strs[0])
+	}
+}
+
+func TestInjectFaultTimes(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.InjectFault(Fault{Method: http.MethodGet, Path: "/projects/1", Status: http.StatusTooManyRequests, Times: 2})
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(srv.APIRoot() + "/projects/1/files")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+	}
+	if codes[0] != 429 || codes[1] != 429 || codes[2] != 200 {
+		t.Errorf("statuses %v, want two faults then success", codes)
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("recorded %d requests, want 3", n)
+	}
+}
+
+func TestToken(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Token = "secret"
+
+	req, _ := http.NewRequest(http.MethodGet, srv.APIRoot()+"/projects/1/files", nil)
+	req.Header.Set("Authorization", "wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status %d with a wrong token, want 401", resp.StatusCode)
+	}
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.AddFile(1, "StoryData/Test.json", []String{{Key: "a", Original: "x", Translation: "y", Stage: 1}})
+
+	resp, err := http.Get(srv.APIRoot() + "/projects/1/artifacts/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "raw/StoryData/Test.json.json" || zr.File[1].Name != "utf8/StoryData/Test.json.json" {
+		t.Fatalf("artifact holds %v, want the file under raw and utf8", zr.File)
+	}
+	fr, _ := zr.File[0].Open()
+	defer fr.Close()
+	strs := []String{}
+	if err := json.NewDecoder(fr).Decode(&strs); err != nil {
+		t.Fatal(err)
+	}
+	if len(strs) != 1 || strs[0].Translation != "y" {
+		t.Errorf("artifact strings %+v, want the translation", strs)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	id := srv.AddFile(1, "Test.json", []String{{Key: "a", Original: "x", Translation: "y", Stage: 5}})
+	send := func(method, url, body string) int {
+		req, _ := http.NewRequest(method, srv.APIRoot()+url, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := send(http.MethodPost, "/projects/1/strings", `{"key": "b", "original": "z", "file": `+strconv.Itoa(id)+`}`); code != http.StatusOK {
+		t.Fatalf("create string status %d", code)
+	}
+	if code := send(http.MethodPost, "/projects/1/strings", `{"key": "b", "original": "z", "file": `+strconv.Itoa(id)+`}`); code != http.StatusBadRequest {
+		t.Errorf("create of an existing key status %d, want 400", code)
+	}
+
+	strs := srv.Strings(1, id)
+	if len(strs) != 2 || strs[1].Key != "b" || strs[1].ID == 0 {
+		t.Fatalf("strings %+v, want b appended with an id", strs)
+	}
+
+	if code := send(http.MethodPut, "/projects/1/strings/"+strconv.Itoa(strs[0].ID), `{"stage": 2}`); code != http.StatusOK {
+		t.Fatalf("update string status %d", code)
+	}
+	if got := srv.Strings(1, id)[0]; got.Stage != 2 || got.Translation != "y" {
+		t.Errorf("updated string %+v, want only the stage changed", got)
+	}
+
+	if code := send(http.MethodDelete, "/projects/1/strings/"+strconv.Itoa(strs[1].ID), ""); code != http.StatusOK {
+		t.Fatalf("delete string status %d", code)
+	}
+	if code := send(http.MethodDelete, "/projects/1/strings/"+strconv.Itoa(strs[1].ID), ""); code != http.StatusNotFound {
+		t.Errorf("second delete status %d, want 404", code)
+	}
+	if n := len(srv.Strings(1, id)); n != 1 {
+		t.Errorf("%d strings after the delete, want 1", n)
+	}
+}
+
+func TestTermsPaging(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	for i := 0; i < 3; i++ {
+		srv.AddTerm(1, Term{Term: "t" + strconv.Itoa(i), Translation: "x"})
+	}
+
+	resp, err := http.Get(srv.APIRoot() + "/projects/1/terms?page=2&pageSize=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page := struct {
+		PageCount int    `json:"pageCount"`
+		RowCount  int    `json:"rowCount"`
+		Results   []Term `json:"results"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.PageCount != 2 || page.RowCount != 3 || len(page.Results) != 1 || page.Results[0].Term != "t2" {
+		t.Errorf("second page %+v, want only t2 of 3 terms", page)
+	}
+
+	resp = post(t, srv.APIRoot()+"/projects/1/terms", "", nil, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("term without json status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestTriggerArtifact(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.APIRoot() + "/projects/1/artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("artifact before any was generated status %d, want 404", resp.StatusCode)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	srv.SetArtifact(1, old)
+	resp, err = http.Post(srv.APIRoot()+"/projects/1/artifacts", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.APIRoot() + "/projects/1/artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	artifact := struct {
+		CreatedAt time.Time `json:"createdAt"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&artifact); err != nil {
+		t.Fatal(err)
+	}
+	if !artifact.CreatedAt.After(old) {
+		t.Errorf("artifact created at %v after the trigger, want a newer one", artifact.CreatedAt)
+	}
+}
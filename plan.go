@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+)
+
+// filePlan is what a sync would do to one paratranz file.
+type filePlan struct {
+	Action         string   `json:"action"`
+	File           string   `json:"file"`
+	ID             int      `json:"id,omitempty"`
+	Strings        int      `json:"strings"`
+	Translated     int      `json:"translated,omitempty"`
+	Added          []string `json:"added,omitempty"`
+	Removed        []string `json:"removed,omitempty"`
+	Changed        []string `json:"changed,omitempty"`
+	ContextChanges int      `json:"contextChanges,omitempty"`
+}
+
+type syncPlan struct {
+	Files []filePlan `json:"files"`
+}
+
+// planSync reads the current state of every changed file and reports what
+// the sync would do, without calling any mutating endpoint.
+func planSync(ctx context.Context, h *ParatranzHandler, changes []assetChange) error {
+	zap.S().Infoln("Start dry run plan", len(changes))
+
+	plan := syncPlan{Files: make([]filePlan, len(changes))}
+
+	jobs := []fileJob{}
+	for i, c := range changes {
+		jobs = append(jobs, fileJob{name: c.name, run: func(ctx context.Context) error {
+			fp, err := planFile(ctx, h, c)
+			plan.Files[i] = fp
+			return err
+		}})
+	}
+
+	if err := runJobs(ctx, "plan", jobs); err != nil {
+		return err
+	}
+
+	printPlan(plan)
+
+	b, err := JSONMarshal(plan)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal plan: %w", err)
+	}
+
+	planOutput := cfg.dumpPath("sync_plan.json")
+	os.MkdirAll(filepath.Dir(planOutput), os.ModePerm)
+	if err := os.WriteFile(planOutput, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+
+	zap.S().Infoln("plan written to", planOutput)
+	return nil
+}
+
+func planFile(ctx context.Context, h *ParatranzHandler, c assetChange) (filePlan, error) {
+	fp := filePlan{Action: c.action, File: c.name, ID: c.pf.ID}
+
+	var current []ParatranzTranslation
+	if c.action != actionCreate {
+		err := retryWithBackoff(ctx, func() error {
+			trans, err := h.GetTranslation(ctx, c.pf.ID)
+			current = trans
+			return err
+		})
+		if err != nil {
+			return fp, fmt.Errorf("GetTranslation %s %d: %w", c.pf.Name, c.pf.ID, err)
+		}
+	}
+
+	if c.action == actionDelete {
+		fp.Strings = len(current)
+		for _, t := range current {
+			fp.Removed = append(fp.Removed, t.Key)
+			if t.Translation != "" {
+				fp.Translated++
+			}
+		}
+		return fp, nil
+	}
+
+	// the strings paratranz will hold once the KR file is uploaded
+	next := current
+	if c.action != actionContext {
+		krPath := cfg.sourcePath(c.folder, c.file)
+		_, krPMData, err := getPMData(krPath)
+		if err != nil {
+			return fp, err
+		}
+
+		krTran := krPMData.getTranMap()
+		d := diffStrings(current, krTran)
+
+		fp.Added = d.added
+		next = []ParatranzTranslation{}
+		for _, key := range d.added {
+			next = append(next, ParatranzTranslation{Key: key, Original: krTran[key]})
+		}
+		for _, t := range d.changed {
+			fp.Changed = append(fp.Changed, t.Key)
+			t.Original = krTran[t.Key]
+			next = append(next, t)
+		}
+		for _, t := range d.removed {
+			fp.Removed = append(fp.Removed, t.Key)
+		}
+		next = append(next, d.unchanged...)
+		sort.Strings(fp.Removed)
+		sort.Strings(fp.Changed)
+	}
+
+	fp.Strings = len(next)
+
+	before := map[string]string{}
+	for _, t := range next {
+		before[t.Key] = t.Context
+	}
+	for _, t := range withContext(append([]ParatranzTranslation(nil), next...), c.folder, c.file) {
+		if before[t.Key] != t.Context {
+			fp.ContextChanges++
+		}
+	}
+
+	return fp, nil
+}
+
+func printPlan(plan syncPlan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tFILE\tID\tSTRINGS\tADDED\tREMOVED\tCHANGED\tCONTEXT")
+
+	count := map[string]int{}
+	for _, fp := range plan.Files {
+		count[fp.Action]++
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n", fp.Action, fp.File, fp.ID, fp.Strings, len(fp.Added), len(fp.Removed), len(fp.Changed), fp.ContextChanges)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d create, %d update, %d move, %d delete, %d context only\n", count[actionCreate], count[actionUpdate], count[actionMove], count[actionDelete], count[actionContext])
+}
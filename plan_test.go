@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestDryRunPlan(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	srv.AddFile(1, "StoryData/Old.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "하나", Translation: "一", Stage: 1},
+		{Key: "dataList->1->content", Original: "둘"},
+	})
+	srv.AddFile(1, "StoryData/Gone.json", []paratranztest.String{{Key: "a", Original: "x", Translation: "y", Stage: 1}})
+
+	defer func() { dryRun, assetsContextUpdate, syncFromLists = false, false, false }()
+	paraid, token, apiRoot, rateLimit, dryRun, assetsContextUpdate, syncFromLists = 1, "test", srv.APIRoot(), 0, true, false, true
+
+	writeAsset(t, "Assets", "kr", "Old.json", "하나", "셋")
+	writeAsset(t, "Assets", "kr", "New.json", "새")
+	os.MkdirAll("dump", os.ModePerm)
+	list := "M\tkr/StoryData/KR_Old.json\nA\tkr/StoryData/KR_New.json\nD\tkr/StoryData/KR_Gone.json\n"
+	if err := os.WriteFile(filepath.Join("dump", "kr_files.txt"), []byte(list), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateFromAssets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range srv.Requests() {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("dry run sent %s", r)
+		}
+	}
+
+	b, err := os.ReadFile(cfg.dumpPath("sync_plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := syncPlan{}
+	if err := json.Unmarshal(b, &plan); err != nil {
+		t.Fatal(err)
+	}
+	byFile := map[string]filePlan{}
+	for _, fp := range plan.Files {
+		byFile[fp.File] = fp
+	}
+
+	if fp := byFile["StoryData/Old.json"]; fp.Action != actionUpdate || len(fp.Changed) != 1 || fp.Changed[0] != "dataList->1->content" {
+		t.Errorf("Old.json plan %+v, want an update changing the second content", fp)
+	}
+	if fp := byFile["StoryData/New.json"]; fp.Action != actionCreate || len(fp.Added) == 0 {
+		t.Errorf("New.json plan %+v, want a create", fp)
+	}
+	if fp := byFile["StoryData/Gone.json"]; fp.Action != actionDelete || fp.Translated != 1 {
+		t.Errorf("Gone.json plan %+v, want a delete losing one translation", fp)
+	}
+}
+
+func TestReadOnlyHandler(t *testing.T) {
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+
+	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()), WithReadOnly())
+	if err := h.DeleteFile(context.Background(), 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DeleteFile on a read only handler = %v, want ErrReadOnly", err)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("read only handler sent %d requests", n)
+	}
+}
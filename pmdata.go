@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// span is where a value sits in the raw file, end is exclusive. member is
+// where its object key starts, start for array elements.
+type span struct {
+	start, end int
+	member     int
+}
+
+// Bytes is the file as read with only the edited values replaced, so key
+// order, number literals, BOM and whitespace stay those of the asset.
+func (pm *PMData) Bytes() ([]byte, error) {
+	if len(pm.edits) == 0 && len(pm.deletes) == 0 {
+		return pm.raw, nil
+	}
+
+	spans, err := indexJSON(pm.raw)
+	if err != nil {
+		return nil, err
+	}
+
+	type replace struct {
+		span
+		value []byte
+	}
+	replaces := []replace{}
+	for path, value := range pm.edits {
+		if pm.deleted(path) {
+			continue
+		}
+		sp, has := spans[path]
+		if !has {
+			return nil, fmt.Errorf("no value at %s", path)
+		}
+		replaces = append(replaces, replace{sp, value})
+	}
+	for _, sp := range pm.deleteSpans(spans) {
+		replaces = append(replaces, replace{sp, nil})
+	}
+	sort.Slice(replaces, func(i, j int) bool { return replaces[i].start < replaces[j].start })
+
+	out := bytes.Buffer{}
+	last := 0
+	for _, r := range replaces {
+		if r.start < last {
+			return nil, fmt.Errorf("overlapping edits at offset %d", r.start)
+		}
+		out.Write(pm.raw[last:r.start])
+		out.Write(r.value)
+		last = r.end
+	}
+	out.Write(pm.raw[last:])
+	return out.Bytes(), nil
+}
+
+// set replaces the value at a getTranMap style path, like dataList->3->id,
+// in the decoded data and in the bytes written by Bytes.
+func (pm *PMData) set(path string, v any) error {
+	value, err := encodeJSONValue(v)
+	if err != nil {
+		return err
+	}
+
+	keys := strings.Split(path, "->")
+	if len(keys) < 2 || keys[0] != "dataList" {
+		return fmt.Errorf("path %s is not below dataList", path)
+	}
+	i, err := strconv.Atoi(keys[1])
+	if err != nil || i < 0 || i >= len(pm.DataList) {
+		return fmt.Errorf("no value at %s", path)
+	}
+	if !setDecoded(pm.DataList[i], keys[2:], v) {
+		return fmt.Errorf("no value at %s", path)
+	}
+
+	pm.edit(path, value)
+	return nil
+}
+
+func (pm *PMData) edit(path string, value []byte) {
+	if pm.edits == nil {
+		pm.edits = map[string][]byte{}
+	}
+	pm.edits[path] = value
+}
+
+// remove deletes the value at a getTranMap style path. The decoded data
+// keeps it until applyDeletes, so paths of later edits still refer to the
+// asset as read.
+func (pm *PMData) remove(path string) error {
+	if _, has := pm.get(path); !has {
+		return fmt.Errorf("no value at %s", path)
+	}
+	if pm.deletes == nil {
+		pm.deletes = map[string]bool{}
+	}
+	pm.deletes[path] = true
+	return nil
+}
+
+// deleted reports whether path or a value above it is removed.
+func (pm *PMData) deleted(path string) bool {
+	for p := path; ; {
+		if pm.deletes[p] {
+			return true
+		}
+		i := strings.LastIndex(p, "->")
+		if i < 0 {
+			return false
+		}
+		p = p[:i]
+	}
+}
+
+// applyDeletes removes the values given to remove from the decoded data,
+// last index first so the earlier ones keep their place.
+func (pm *PMData) applyDeletes() {
+	paths := []string{}
+	for p := range pm.deletes {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return comparePaths(paths[i], paths[j]) > 0 })
+
+	for _, p := range paths {
+		keys := strings.Split(p, "->")
+		if len(keys) == 2 {
+			i, _ := strconv.Atoi(keys[1])
+			pm.DataList = append(pm.DataList[:i:i], pm.DataList[i+1:]...)
+			continue
+		}
+		i, _ := strconv.Atoi(keys[1])
+		above := keys[2 : len(keys)-1]
+		parent, _ := getDecoded(pm.DataList[i], above)
+		last := keys[len(keys)-1]
+
+		var kept any
+		switch vt := parent.(type) {
+		case map[string]any:
+			m := make(map[string]any, len(vt))
+			for k, v := range vt {
+				if k != last {
+					m[k] = v
+				}
+			}
+			kept = m
+		case []any:
+			j, _ := strconv.Atoi(last)
+			kept = append(vt[:j:j], vt[j+1:]...)
+		}
+
+		if len(above) == 0 {
+			pm.DataList[i] = kept.(map[string]any)
+		} else {
+			setDecoded(pm.DataList[i], above, kept)
+		}
+	}
+}
+
+// comparePaths orders paths key by key, array indexes by number.
+func comparePaths(a, b string) int {
+	ak, bk := strings.Split(a, "->"), strings.Split(b, "->")
+	for i := 0; i < len(ak) && i < len(bk); i++ {
+		if ak[i] == bk[i] {
+			continue
+		}
+		an, aerr := strconv.Atoi(ak[i])
+		bn, berr := strconv.Atoi(bk[i])
+		if aerr == nil && berr == nil {
+			return an - bn
+		}
+		return strings.Compare(ak[i], bk[i])
+	}
+	return len(ak) - len(bk)
+}
+
+// deleteSpans is the text to cut for the removed values. A value is cut up
+// to the next member of its container, the last kept member is followed by
+// the removed ones after it, so no comma is left dangling.
+func (pm *PMData) deleteSpans(spans map[string]span) []span {
+	byParent := map[string]bool{}
+	for p := range pm.deletes {
+		i := strings.LastIndex(p, "->")
+		if i < 0 || pm.deleted(p[:i]) {
+			continue
+		}
+		byParent[p[:i]] = true
+	}
+
+	cuts := []span{}
+	for parent := range byParent {
+		members := []string{}
+		for p := range spans {
+			if i := strings.LastIndex(p, "->"); i >= 0 && p[:i] == parent {
+				members = append(members, p)
+			}
+		}
+		sort.Slice(members, func(i, j int) bool { return spans[members[i]].member < spans[members[j]].member })
+
+		lastKept := -1
+		for i, p := range members {
+			if !pm.deletes[p] {
+				lastKept = i
+			}
+		}
+		for i, p := range members {
+			if pm.deletes[p] && i < lastKept {
+				cuts = append(cuts, span{start: spans[p].member, end: spans[members[i+1]].member})
+			}
+		}
+		if lastKept < len(members)-1 {
+			start := spans[members[0]].member
+			if lastKept >= 0 {
+				start = spans[members[lastKept]].end
+			}
+			cuts = append(cuts, span{start: start, end: spans[members[len(members)-1]].end})
+		}
+	}
+	return cuts
+}
+
+// get returns the decoded value at a getTranMap style path.
+func (pm *PMData) get(path string) (any, bool) {
+	keys := strings.Split(path, "->")
+	if len(keys) < 2 || keys[0] != "dataList" {
+		return nil, false
+	}
+	i, err := strconv.Atoi(keys[1])
+	if err != nil || i < 0 || i >= len(pm.DataList) {
+		return nil, false
+	}
+	return getDecoded(pm.DataList[i], keys[2:])
+}
+
+func getDecoded(node any, keys []string) (any, bool) {
+	for _, k := range keys {
+		switch vt := node.(type) {
+		case map[string]any:
+			sub, has := vt[k]
+			if !has {
+				return nil, false
+			}
+			node = sub
+		case []any:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(vt) {
+				return nil, false
+			}
+			node = vt[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func setDecoded(node any, keys []string, v any) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	last := len(keys) == 1
+
+	switch vt := node.(type) {
+	case map[string]any:
+		sub, has := vt[keys[0]]
+		if !has {
+			return false
+		}
+		if last {
+			vt[keys[0]] = v
+			return true
+		}
+		return setDecoded(sub, keys[1:], v)
+	case []any:
+		i, err := strconv.Atoi(keys[0])
+		if err != nil || i < 0 || i >= len(vt) {
+			return false
+		}
+		if last {
+			vt[i] = v
+			return true
+		}
+		return setDecoded(vt[i], keys[1:], v)
+	}
+	return false
+}
+
+// encodeJSONValue encodes like JSONMarshal, without the trailing newline.
+func encodeJSONValue(v any) ([]byte, error) {
+	b, err := JSONMarshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b, []byte("\n")), nil
+}
+
+// indexJSON finds the span of every value in data by its path, object keys
+// and array indexes joined with ->. A leading BOM is skipped.
+func indexJSON(data []byte) (map[string]span, error) {
+	offset := 0
+	if bytes.HasPrefix(data, utf8BOM) {
+		offset = len(utf8BOM)
+	}
+	body := data[offset:]
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	spans := map[string]span{}
+	if err := indexValue(dec, body, offset, nil, spans); err != nil {
+		return nil, fmt.Errorf("index json: %w", err)
+	}
+	return spans, nil
+}
+
+func indexValue(dec *json.Decoder, body []byte, offset int, keys []string, spans map[string]span) error {
+	start := skipSeparators(body, int(dec.InputOffset()))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if delim, ok := tok.(json.Delim); ok {
+		switch delim {
+		case '{':
+			for dec.More() {
+				member := skipSeparators(body, int(dec.InputOffset()))
+				kt, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, ok := kt.(string)
+				if !ok {
+					return fmt.Errorf("object key %v is not a string", kt)
+				}
+				if err := indexValue(dec, body, offset, append(keys, key), spans); err != nil {
+					return err
+				}
+				p := strings.Join(append(keys, key), "->")
+				sp := spans[p]
+				sp.member = offset + member
+				spans[p] = sp
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err := indexValue(dec, body, offset, append(keys, strconv.Itoa(i)), spans); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	if len(keys) > 0 {
+		spans[strings.Join(keys, "->")] = span{start: offset + start, end: offset + int(dec.InputOffset()), member: offset + start}
+	}
+	return nil
+}
+
+// skipSeparators moves past what the decoder leaves between two values.
+func skipSeparators(body []byte, i int) int {
+	for i < len(body) {
+		switch body[i] {
+		case ' ', '\t', '\r', '\n', ':', ',':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
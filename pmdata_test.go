@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func parsePMData(t *testing.T, raw string) *PMData {
+	t.Helper()
+
+	pm := PMData{raw: []byte(raw)}
+	if err := json.Unmarshal(bytes.TrimPrefix(pm.raw, utf8BOM), &pm); err != nil {
+		t.Fatal(err)
+	}
+	return &pm
+}
+
+func TestPMDataBytes(t *testing.T) {
+	const asset = "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"id\": 2, \"content\": \"b\", \"tag\": [\"x\", \"y\"]},\n    {\"id\": 3, \"content\": \"c\"}\n  ]\n}\n"
+
+	tests := []struct {
+		name    string
+		raw     string
+		set     map[string]any
+		edit    map[string]string
+		remove  []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "unchanged",
+			raw:  asset,
+			want: asset,
+		},
+		{
+			name: "set keeps the layout",
+			raw:  asset,
+			set:  map[string]any{"dataList->1->content": "乙 \"quoted\"", "dataList->2->id": "3"},
+			want: "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"id\": 2, \"content\": \"乙 \\\"quoted\\\"\", \"tag\": [\"x\", \"y\"]},\n    {\"id\": \"3\", \"content\": \"c\"}\n  ]\n}\n",
+		},
+		{
+			name: "bom kept",
+			raw:  "\xef\xbb\xbf{\"dataList\": [{\"content\": \"a\"}]}",
+			set:  map[string]any{"dataList->0->content": "b"},
+			want: "\xef\xbb\xbf{\"dataList\": [{\"content\": \"b\"}]}",
+		},
+		{
+			name:   "delete middle entry",
+			raw:    asset,
+			remove: []string{"dataList->1"},
+			want:   "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"id\": 3, \"content\": \"c\"}\n  ]\n}\n",
+		},
+		{
+			name:   "delete last entry",
+			raw:    asset,
+			remove: []string{"dataList->2"},
+			want:   "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"id\": 2, \"content\": \"b\", \"tag\": [\"x\", \"y\"]}\n  ]\n}\n",
+		},
+		{
+			name:   "delete every entry",
+			raw:    asset,
+			remove: []string{"dataList->0", "dataList->1", "dataList->2"},
+			want:   "{\n  \"dataList\": [\n    \n  ]\n}\n",
+		},
+		{
+			name:   "delete first and last members",
+			raw:    asset,
+			remove: []string{"dataList->1->id", "dataList->1->tag"},
+			want:   "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"content\": \"b\"},\n    {\"id\": 3, \"content\": \"c\"}\n  ]\n}\n",
+		},
+		{
+			name:   "delete array element",
+			raw:    asset,
+			remove: []string{"dataList->1->tag->0"},
+			want:   "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"id\": 2, \"content\": \"b\", \"tag\": [\"y\"]},\n    {\"id\": 3, \"content\": \"c\"}\n  ]\n}\n",
+		},
+		{
+			name:   "edit below a deleted entry is dropped",
+			raw:    asset,
+			set:    map[string]any{"dataList->1->content": "乙", "dataList->2->content": "丙"},
+			remove: []string{"dataList->1"},
+			want:   "{\n  \"dataList\": [\n    {\"id\": 1, \"content\": \"a\"},\n    {\"id\": 3, \"content\": \"丙\"}\n  ]\n}\n",
+		},
+		{
+			name:    "edit of a missing value",
+			raw:     asset,
+			edit:    map[string]string{"dataList->0->missing": `"x"`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := decodePMData([]byte(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, v := range tt.set {
+				if err := pm.set(path, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for path, v := range tt.edit {
+				pm.edit(path, []byte(v))
+			}
+			for _, path := range tt.remove {
+				if err := pm.remove(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := pm.Bytes()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Bytes error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("Bytes =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPMDataSet(t *testing.T) {
+	pm := parsePMData(t, `{"dataList": [{"id": 1, "content": "a"}]}`)
+
+	for _, path := range []string{"dataList->1->content", "dataList->0->missing", "other->0"} {
+		if err := pm.set(path, "x"); err == nil {
+			t.Errorf("set %s succeeded, want an error", path)
+		}
+	}
+	if len(pm.edits) != 0 {
+		t.Errorf("failed sets recorded edits %v", pm.edits)
+	}
+}
+
+func TestSetFromTranMapSplices(t *testing.T) {
+	pm := parsePMData(t, "{\"dataList\": [\n  {\"id\": 1.0, \"content\": \"a\", \"model\": \"m\"}\n]}")
+
+	if err := pm.setFromTranMap(map[string]string{"dataList->0->content": "甲\n", "dataList->0->model": "m"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pm.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"dataList\": [\n  {\"id\": 1.0, \"content\": \"甲\\n\", \"model\": \"m\"}\n]}"; string(got) != want {
+		t.Errorf("Bytes =\n%s\nwant\n%s", got, want)
+	}
+}
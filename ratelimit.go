@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 2 * time.Minute
+)
+
+// retryMaxAttempts caps how often retryWithBackoff calls fn.
+var retryMaxAttempts = 8
+
+// rateLimiter is a token bucket shared by every request of a handler. A
+// server side rate limit pauses the whole bucket, not only the caller that
+// hit it.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	paused time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return ctx.Err()
+	}
+
+	for {
+		delay := l.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token and returns zero, or returns how long to wait before
+// trying again.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Pause holds every request back for d and drains the bucket.
+func (l *rateLimiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.paused) {
+		l.paused = until
+	}
+	l.tokens = 0
+}
+
+// rateLimitWait reads Retry-After or the X-RateLimit-* / RateLimit-* headers
+// and returns how long the server asked us to wait, zero if it did not.
+func rateLimitWait(header http.Header, now time.Time) time.Duration {
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil && t.After(now) {
+			return t.Sub(now)
+		}
+	}
+
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if header.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		reset, err := strconv.ParseInt(header.Get(prefix+"Reset"), 10, 64)
+		if err != nil {
+			continue
+		}
+		// large values are unix timestamps, small ones are seconds to wait
+		if reset > now.Unix()-3600 {
+			if t := time.Unix(reset, 0); t.After(now) {
+				return t.Sub(now)
+			}
+			continue
+		}
+		return time.Duration(reset) * time.Second
+	}
+
+	return 0
+}
+
+// errNotSent marks a request that failed before any of it reached paratranz.
+var errNotSent = errors.New("request not sent")
+
+// sentError is a failed non-idempotent request paratranz may have applied
+// anyway, another attempt could create the resource twice.
+type sentError struct{ err error }
+
+func (e *sentError) Error() string { return e.err.Error() }
+func (e *sentError) Unwrap() error { return e.err }
+
+// onceSent keeps retryWithBackoff from repeating a non-idempotent request
+// unless it was rate limited or never sent.
+func onceSent(err error) error {
+	if err == nil || errors.Is(err, ErrRateLimited) || errors.Is(err, errNotSent) {
+		return err
+	}
+	return &sentError{err}
+}
+
+// isRetryable reports whether err is a rate limit, a server side failure or a
+// transient network error that is worth another attempt.
+func isRetryable(err error) bool {
+	var sent *sentError
+	if errors.As(err, &sent) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, errNotSent) {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// backoffDelay is an exponential delay with jitter that never undercuts what
+// the server asked for.
+func backoffDelay(attempt int, retryAfter time.Duration) time.Duration {
+	d := retryBaseDelay << (attempt - 1)
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return d
+}
+
+func retryWithBackoff(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		if attempt >= retryMaxAttempts {
+			logger(ctx).Warnw("giving up after retries", "attempts", attempt, "error", err)
+			return err
+		}
+
+		var retryAfter time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			retryAfter = apiErr.RetryAfter
+		}
+
+		delay := backoffDelay(attempt, retryAfter)
+		logger(ctx).Warnw("retrying after error", "attempt", attempt, "delay", delay, "error", err)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{"none", nil, 0},
+		{"retry after seconds", map[string]string{"Retry-After": "30"}, 30 * time.Second},
+		{"retry after date", map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)}, 90 * time.Second},
+		{"retry after past date", map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}, 0},
+		{"retry after garbage", map[string]string{"Retry-After": "soon"}, 0},
+		{"reset seconds", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "12"}, 12 * time.Second},
+		{"reset timestamp", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(45*time.Second).Unix(), 10)}, 45 * time.Second},
+		{"reset timestamp passed", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(-time.Second).Unix(), 10)}, 0},
+		{"remaining left", map[string]string{"X-RateLimit-Remaining": "3", "X-RateLimit-Reset": "12"}, 0},
+		{"ietf draft headers", map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "5"}, 5 * time.Second},
+		{"retry after first", map[string]string{"Retry-After": "2", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "12"}, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			if got := rateLimitWait(header, now); got != tt.want {
+				t.Errorf("rateLimitWait = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&APIError{StatusCode: http.StatusBadGateway}, true},
+		{&APIError{StatusCode: http.StatusNotFound}, false},
+		{fmt.Errorf("UploadFile: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{context.Canceled, false},
+		{ErrEmptyFile, false},
+		{onceSent(&APIError{StatusCode: http.StatusBadGateway}), false},
+		{onceSent(&APIError{StatusCode: http.StatusTooManyRequests}), true},
+		{onceSent(fmt.Errorf("%w: %w", errNotSent, syscall.ECONNREFUSED)), true},
+		{onceSent(fmt.Errorf("CreateString: %w", io.ErrUnexpectedEOF)), false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	l := newRateLimiter(1000, 2)
+	now := time.Now()
+	if d := l.reserve(now); d != 0 {
+		t.Fatalf("first reserve waits %v, want a token from the burst", d)
+	}
+
+	l.Pause(time.Hour)
+	if d := l.reserve(time.Now()); d < 59*time.Minute {
+		t.Errorf("reserve after a pause waits %v, want the pause", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait on a paused limiter = %v, want the context deadline", err)
+	}
+}
+
+func TestRetryWithBackoffRetriesServerErrors(t *testing.T) {
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	srv.InjectFault(paratranztest.Fault{Method: http.MethodGet, Status: http.StatusBadGateway, Times: 1})
+
+	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()), WithRateLimit(0, 0))
+	start := time.Now()
+	err := retryWithBackoff(context.Background(), func() error {
+		_, err := h.GetFiles(context.Background())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("sent %d requests, want the failed one and a retry", n)
+	}
+	if d := time.Since(start); d < retryBaseDelay/2 {
+		t.Errorf("retried after %v, want at least half the base delay", d)
+	}
+}
+
+func TestRetryWithBackoffNonIdempotent(t *testing.T) {
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	id := srv.AddFile(1, "Test.json", []paratranztest.String{{Key: "a", Original: "x"}})
+	srv.InjectFault(paratranztest.Fault{Method: http.MethodPost, Status: http.StatusBadGateway, Times: 1})
+
+	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()), WithRateLimit(0, 0))
+	original := "y"
+	create := func() error {
+		_, err := h.CreateString(context.Background(), ParatranzString{Key: "b", Original: &original, File: &id})
+		return err
+	}
+	var apiErr *APIError
+	if err := retryWithBackoff(context.Background(), create); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("CreateString = %v, want the 502", err)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("sent %d requests, want no retry of a create that may have been applied", n)
+	}
+
+	srv.InjectFault(paratranztest.Fault{Method: http.MethodPost, Status: http.StatusTooManyRequests, Times: 1})
+	if err := retryWithBackoff(context.Background(), create); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("sent %d requests, want the rate limited create retried", n)
+	}
+}
+
+func TestDoNotSent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	h := NewParatranzHandler(1, "token", WithAPIRoot("http://"+addr), WithRateLimit(0, 0))
+	err = h.TriggerArtifact(context.Background())
+	if !errors.Is(err, errNotSent) || !isRetryable(err) {
+		t.Errorf("TriggerArtifact on a closed port = %v, want a retryable unsent error", err)
+	}
+}
+
+func TestDoTimeoutExcludesLimiterWait(t *testing.T) {
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+
+	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()), WithRateLimit(0, 0), WithRequestTimeout(50*time.Millisecond))
+	h.limiter = newRateLimiter(1000, 1)
+	h.limiter.Pause(100 * time.Millisecond)
+	if _, err := h.GetFiles(context.Background()); err != nil {
+		t.Errorf("GetFiles after a pause longer than the request timeout = %v, want success", err)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	releaseFromArtifact = false
+	releasePrevious     = ""
+	releaseOut          = "export/ReleaseNotes.md"
+	releaseNotesFile    = "RHOY/Information.json"
+)
+
+// releaseNotesKey is the string holding the hand-written notes.
+const releaseNotesKey = "ReleaseNotes"
+
+func releaseSnapshotPath() string {
+	return cfg.dumpPath("release_snapshot.json")
+}
+
+// releaseSnapshot is the state of the project at a release, the stage of
+// every translated string by file and key. The next release diffs against it.
+type releaseSnapshot struct {
+	CreatedAt time.Time                 `json:"createdAt"`
+	Project   int                       `json:"project"`
+	Commit    string                    `json:"commit"`
+	Files     map[string]map[string]int `json:"files"`
+}
+
+func loadReleaseSnapshot(p string) (*releaseSnapshot, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	s := &releaseSnapshot{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("read release snapshot %s: %w", p, err)
+	}
+	return s, nil
+}
+
+// releaseFolder is the top folder of a file name, "" for files at the root.
+func releaseFolder(name string) string {
+	folder, _, found := strings.Cut(name, "/")
+	if !found {
+		return ""
+	}
+	return folder
+}
+
+type releaseCount struct {
+	Translated int
+	Reviewed   int
+}
+
+// releaseDiff counts the strings of cur translated or reviewed since prev,
+// by folder, and lists the files with their first translated strings.
+func releaseDiff(prev, cur *releaseSnapshot) (map[string]*releaseCount, []string) {
+	counts := map[string]*releaseCount{}
+	newFiles := []string{}
+	for name, stages := range cur.Files {
+		before := prev.Files[name]
+		if len(stages) > 0 && len(before) == 0 {
+			newFiles = append(newFiles, name)
+		}
+
+		c := &releaseCount{}
+		for key, stage := range stages {
+			old := before[key]
+			if old < stageTranslated {
+				c.Translated++
+			}
+			if stage >= stageReviewed && old < stageReviewed {
+				c.Reviewed++
+			}
+		}
+		if c.Translated == 0 && c.Reviewed == 0 {
+			continue
+		}
+
+		folder := releaseFolder(name)
+		if counts[folder] == nil {
+			counts[folder] = &releaseCount{}
+		}
+		counts[folder].Translated += c.Translated
+		counts[folder].Reviewed += c.Reviewed
+	}
+	sort.Strings(newFiles)
+	return counts, newFiles
+}
+
+// buildReleaseNotes appends to releaseOut the hand-written notes of the
+// project followed by what changed since the previous release snapshot,
+// the progress of the project and the assets commit, then saves the new
+// snapshot.
+func buildReleaseNotes(ctx context.Context) error {
+	zap.S().Infoln("Start release notes of project", paraid, "from artifact:", releaseFromArtifact)
+
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
+	}
+
+	cur := &releaseSnapshot{CreatedAt: time.Now().UTC(), Project: paraid, Files: map[string]map[string]int{}}
+	notes := ""
+
+	var mu sync.Mutex
+	jobs := []fileJob{}
+	for _, f := range sortedFiles(m) {
+		jobs = append(jobs, fileJob{name: f.Name, run: func(ctx context.Context) error {
+			trans, err := releaseStrings(ctx, h, f)
+			if err != nil {
+				return err
+			}
+
+			stages := map[string]int{}
+			for _, t := range trans {
+				if t.Stage >= stageTranslated && t.Translation != "" {
+					stages[t.Key] = t.Stage
+				}
+				if f.Name == releaseNotesFile && t.Key == releaseNotesKey {
+					mu.Lock()
+					notes = t.Translation
+					mu.Unlock()
+				}
+			}
+
+			mu.Lock()
+			cur.Files[f.Name] = stages
+			mu.Unlock()
+			return nil
+		}})
+	}
+
+	if err := runJobs(ctx, "release notes", jobs); err != nil {
+		return err
+	}
+
+	if commit, err := gitRevParse(ctx, cfg.AssetsRoot, "HEAD"); err != nil {
+		zap.S().Warnw("no assets commit for the release notes", "error", err)
+	} else {
+		cur.Commit = commit
+	}
+
+	if notes == "" {
+		zap.S().Warnw("no hand-written release notes", "file", releaseNotesFile, "key", releaseNotesKey)
+	}
+
+	previous := releasePrevious
+	if previous == "" {
+		previous = releaseSnapshotPath()
+	}
+	prev, err := loadReleaseSnapshot(previous)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		zap.S().Warnw("no previous release snapshot, only progress is listed", "path", previous)
+		prev = nil
+	case err != nil:
+		return err
+	}
+
+	os.MkdirAll(filepath.Dir(releaseOut), os.ModePerm)
+	out, err := os.OpenFile(releaseOut, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("open release notes: %w", err)
+	}
+	writeReleaseNotes(out, notes, prev, cur, sortedFiles(m))
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("write release notes: %w", err)
+	}
+
+	b, err := JSONMarshal(cur)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal release snapshot: %w", err)
+	}
+	p := releaseSnapshotPath()
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err := os.WriteFile(p, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write release snapshot: %w", err)
+	}
+
+	zap.S().Infow("release notes written", "path", releaseOut, "snapshot", p)
+	return nil
+}
+
+// releaseStrings reads the strings of f from the downloaded artifact with
+// releaseFromArtifact, from the api otherwise.
+func releaseStrings(ctx context.Context, h *ParatranzHandler, f ParatranzFile) ([]ParatranzTranslation, error) {
+	if !releaseFromArtifact {
+		var trans []ParatranzTranslation
+		err := retryWithBackoff(ctx, func() error {
+			t, err := h.GetTranslation(ctx, f.ID)
+			trans = t
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetTranslation %s %d: %w", f.Name, f.ID, err)
+		}
+		return trans, nil
+	}
+
+	p := filepath.Join(cfg.artifactRaw(paraid), filepath.FromSlash(f.Name)+".json")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logger(ctx).Warnw("file missing from the artifact", "file", f.Name)
+			return nil, nil
+		}
+		return nil, err
+	}
+	trans := []ParatranzTranslation{}
+	if err := json.Unmarshal(b, &trans); err != nil {
+		return nil, fmt.Errorf("read artifact %s: %w", p, err)
+	}
+	for i := range trans {
+		trans[i].Translation = html.UnescapeString(trans[i].Translation)
+	}
+	return trans, nil
+}
+
+func writeReleaseNotes(w io.Writer, notes string, prev, cur *releaseSnapshot, files []ParatranzFile) {
+	if notes = strings.TrimSpace(notes); notes != "" {
+		fmt.Fprintf(w, "%s\n\n", notes)
+	}
+
+	if prev != nil {
+		counts, newFiles := releaseDiff(prev, cur)
+
+		fmt.Fprintf(w, "## Changes since %s\n\n", prev.CreatedAt.Format("2006-01-02"))
+		if len(counts) == 0 {
+			fmt.Fprintln(w, "No strings were translated or reviewed.")
+			fmt.Fprintln(w)
+		} else {
+			folders := []string{}
+			for folder := range counts {
+				folders = append(folders, folder)
+			}
+			sort.Strings(folders)
+
+			total := releaseCount{}
+			fmt.Fprintln(w, "| Folder | Translated | Reviewed |")
+			fmt.Fprintln(w, "| --- | ---: | ---: |")
+			for _, folder := range folders {
+				c := counts[folder]
+				total.Translated += c.Translated
+				total.Reviewed += c.Reviewed
+				if folder == "" {
+					folder = "/"
+				}
+				fmt.Fprintf(w, "| %s | %d | %d |\n", folder, c.Translated, c.Reviewed)
+			}
+			fmt.Fprintf(w, "| **Total** | %d | %d |\n\n", total.Translated, total.Reviewed)
+		}
+
+		if len(newFiles) > 0 {
+			fmt.Fprintf(w, "### New files (%d)\n\n", len(newFiles))
+			for _, name := range newFiles {
+				fmt.Fprintf(w, "- %s\n", name)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	total, translated, reviewed := 0, 0, 0
+	for _, f := range files {
+		total += f.Total
+		translated += f.Translated
+		reviewed += f.Reviewed
+	}
+	percent := func(n int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	}
+
+	fmt.Fprintln(w, "## Progress")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "- Translated: %d / %d (%.1f%%)\n", translated, total, percent(translated))
+	fmt.Fprintf(w, "- Reviewed: %d / %d (%.1f%%)\n", reviewed, total, percent(reviewed))
+	if cur.Commit != "" {
+		fmt.Fprintf(w, "- Assets commit: `%s`\n", cur.Commit)
+	}
+}
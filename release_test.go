@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestReleaseDiff(t *testing.T) {
+	prev := &releaseSnapshot{Files: map[string]map[string]int{
+		"StoryData/A.json": {"a": stageTranslated, "b": stageReviewed},
+	}}
+	cur := &releaseSnapshot{Files: map[string]map[string]int{
+		"StoryData/A.json": {"a": stageReviewed, "b": stageReviewed, "c": stageTranslated},
+		"UI/B.json":        {"x": stageTranslated},
+		"Root.json":        {},
+	}}
+
+	counts, newFiles := releaseDiff(prev, cur)
+	if c := counts["StoryData"]; c == nil || c.Translated != 1 || c.Reviewed != 1 {
+		t.Errorf("StoryData counts %+v, want c translated and a reviewed", c)
+	}
+	if c := counts["UI"]; c == nil || c.Translated != 1 || c.Reviewed != 0 {
+		t.Errorf("UI counts %+v, want x translated", c)
+	}
+	if _, has := counts[""]; has {
+		t.Error("root folder counted without changes")
+	}
+	if len(newFiles) != 1 || newFiles[0] != "UI/B.json" {
+		t.Errorf("new files %v, want only UI/B.json", newFiles)
+	}
+}
+
+// TestBuildReleaseNotes writes the notes of two releases, the second one
+// diffing against the snapshot of the first.
+func TestBuildReleaseNotes(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+	ctx := context.Background()
+
+	srv.AddFile(1, "RHOY/Information.json", []paratranztest.String{
+		{Key: releaseNotesKey, Original: "notes", Translation: "Fixed typos.", Stage: stageTranslated},
+	})
+	id := srv.AddFile(1, "StoryData/A.json", []paratranztest.String{
+		{Key: "a", Original: "x", Translation: "甲", Stage: stageTranslated},
+		{Key: "b", Original: "y"},
+	})
+	if err := buildReleaseNotes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(releaseOut)
+	if first := string(b); !strings.HasPrefix(first, "Fixed typos.\n") || strings.Contains(first, "Changes since") || !strings.Contains(first, "Translated: 2 / 3") {
+		t.Fatalf("first release notes:\n%s\nwant the notes and the progress only", first)
+	}
+	os.Remove(releaseOut)
+
+	tb, _ := JSONMarshal([]ParatranzTranslation{{Key: "a", Translation: "甲", Stage: stageReviewed}, {Key: "b", Translation: "乙", Stage: stageTranslated}})
+	if err := newParatranzHandler(paraid).UpdateTranslation(ctx, id, tb, "StoryData/A.json", true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := buildReleaseNotes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(releaseOut)
+	if second := string(b); !strings.Contains(second, "| StoryData | 1 | 1 |") || strings.Contains(second, "New files") {
+		t.Errorf("second release notes:\n%s\nwant b translated and a reviewed in StoryData", second)
+	}
+}
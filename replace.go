@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+var replaceYes = false
+
+// replaceRule is one rule of a replace file. Files and Keys are globs
+// matched against the paratranz file name, or any folder above it, and the
+// string key. Empty scopes match everything.
+type replaceRule struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Regex bool     `json:"regex,omitempty"`
+	Word  bool     `json:"word,omitempty"`
+	Files []string `json:"files,omitempty"`
+	Keys  []string `json:"keys,omitempty"`
+
+	line int
+	re   *regexp.Regexp
+}
+
+// readReplaceRules reads the rules in file order. A .json file holds a list
+// of rules, any other file one literal from|to rule per line, skipping blank
+// lines and lines starting with #.
+func readReplaceRules(p string) ([]*replaceRule, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []*replaceRule{}
+	if strings.EqualFold(filepath.Ext(p), ".json") {
+		dec := json.NewDecoder(strings.NewReader(string(b)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rules); err != nil {
+			return nil, fmt.Errorf("read replace rules %s: %w", p, err)
+		}
+		for i, r := range rules {
+			r.line = i + 1
+		}
+	} else {
+		for i, row := range strings.Split(string(b), "\n") {
+			row = strings.TrimSuffix(row, "\r")
+			if strings.TrimSpace(row) == "" || strings.HasPrefix(row, "#") {
+				continue
+			}
+			from, to, found := strings.Cut(row, "|")
+			if !found {
+				return nil, fmt.Errorf("replace rules %s:%d: want from|to, got %q", p, i+1, row)
+			}
+			rules = append(rules, &replaceRule{From: from, To: to, line: i + 1})
+		}
+	}
+
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("replace rules %s: rule %d: %w", p, r.line, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *replaceRule) compile() error {
+	if r.From == "" {
+		return errors.New("empty from")
+	}
+
+	expr := regexp.QuoteMeta(r.From)
+	if r.Regex {
+		expr = r.From
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	r.re = re
+
+	for _, g := range append(append([]string{}, r.Files...), r.Keys...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("glob %q: %w", g, err)
+		}
+	}
+	return nil
+}
+
+func (r *replaceRule) matchFile(name string) bool {
+	if len(r.Files) == 0 {
+		return true
+	}
+	return matchPathGlobs(r.Files, name)
+}
+
+// matchPathGlobs reports whether a glob matches name or a folder above it.
+func matchPathGlobs(globs []string, name string) bool {
+	for _, g := range globs {
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(g, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *replaceRule) matchKey(key string) bool {
+	if len(r.Keys) == 0 {
+		return true
+	}
+	for _, g := range r.Keys {
+		if ok, _ := path.Match(g, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply replaces every match in s. Regex rules expand $1 style groups in To,
+// literal rules insert it as is.
+func (r *replaceRule) apply(s string) string {
+	out := strings.Builder{}
+	last := 0
+	for _, m := range r.re.FindAllStringSubmatchIndex(s, -1) {
+		if m[0] == m[1] || (r.Word && !wordBoundary(s, m[0], m[1])) {
+			continue
+		}
+		out.WriteString(s[last:m[0]])
+		if r.Regex {
+			out.Write(r.re.ExpandString(nil, r.To, s, m))
+		} else {
+			out.WriteString(r.To)
+		}
+		last = m[1]
+	}
+	if last == 0 {
+		return s
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+// wordBoundary reports whether s[start:end] is not part of a longer word.
+func wordBoundary(s string, start, end int) bool {
+	isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	if before, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWord(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && isWord(after) {
+		return false
+	}
+	return true
+}
+
+// replaceChange is one string changed by a replace run.
+type replaceChange struct {
+	File   string
+	FileID int
+	Key    string
+	Stage  int
+	Before string
+	After  string
+	Rules  []int
+}
+
+// replaceFromFile applies the rules of replacefile in order to every
+// translation of the project. The changes are previewed and confirmed
+// before anything is uploaded.
+func replaceFromFile(ctx context.Context, replacefile string) error {
+	zap.S().Infoln("Start replace translation from file:", replacefile)
+
+	rules, err := readReplaceRules(replacefile)
+	if err != nil {
+		return err
+	}
+
+	h := newParatranzHandler(paraid)
+
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("GetFiles %d: %w", paraid, err)
+	}
+
+	var mu sync.Mutex
+	changes := []replaceChange{}
+
+	jobs := []fileJob{}
+	for _, f := range sortedFiles(m) {
+		jobs = append(jobs, fileJob{name: f.Name, run: func(ctx context.Context) error {
+			found, err := replaceInFile(ctx, h, f, rules)
+			mu.Lock()
+			changes = append(changes, found...)
+			mu.Unlock()
+			return err
+		}})
+	}
+
+	if err := runJobs(ctx, "replace", jobs); err != nil {
+		return err
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].File != changes[j].File {
+			return changes[i].File < changes[j].File
+		}
+		return changes[i].Key < changes[j].Key
+	})
+
+	printReplacePreview(os.Stdout, changes)
+	if len(changes) == 0 || dryRun {
+		return nil
+	}
+
+	if !replaceYes && !confirm(fmt.Sprintf("apply %d changes to project %d?", len(changes), paraid)) {
+		return errors.New("replace not confirmed, nothing changed")
+	}
+
+	return pushReplaceChanges(ctx, h, changes)
+}
+
+// replaceInFile returns the changes the rules make to the translations of f.
+func replaceInFile(ctx context.Context, h *ParatranzHandler, f ParatranzFile, rules []*replaceRule) ([]replaceChange, error) {
+	var paraTrans []ParatranzTranslation
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, f.ID)
+		paraTrans = trans
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("GetTranslation %s: %w", f.Name, err)
+	}
+
+	scoped := []*replaceRule{}
+	for _, r := range rules {
+		if r.matchFile(f.Name) {
+			scoped = append(scoped, r)
+		}
+	}
+	if len(scoped) == 0 {
+		return nil, nil
+	}
+
+	changes := []replaceChange{}
+	for _, t := range paraTrans {
+		if t.Translation == "" || isForcedKey(t.Key) {
+			continue
+		}
+
+		c := replaceChange{File: f.Name, FileID: f.ID, Key: t.Key, Stage: t.Stage, Before: t.Translation, After: t.Translation}
+		for _, r := range scoped {
+			if !r.matchKey(t.Key) {
+				continue
+			}
+			if after := r.apply(c.After); after != c.After {
+				c.After = after
+				c.Rules = append(c.Rules, r.line)
+			}
+		}
+		if c.After != c.Before {
+			changes = append(changes, c)
+		}
+	}
+
+	if len(changes) > 0 {
+		logger(ctx).Infoln("change translation", f.Name, len(changes))
+	}
+	return changes, nil
+}
+
+// pushReplaceChanges uploads the changed translations, one request per
+// file, keeping the stages.
+func pushReplaceChanges(ctx context.Context, h *ParatranzHandler, changes []replaceChange) error {
+	byFile := map[int][]replaceChange{}
+	names := map[int]string{}
+	ids := []int{}
+	for _, c := range changes {
+		if _, has := byFile[c.FileID]; !has {
+			ids = append(ids, c.FileID)
+		}
+		byFile[c.FileID] = append(byFile[c.FileID], c)
+		names[c.FileID] = c.File
+	}
+
+	jobs := []fileJob{}
+	for _, id := range ids {
+		name := names[id]
+		jobs = append(jobs, fileJob{name: name, run: func(ctx context.Context) error {
+			trans := []ParatranzTranslation{}
+			for _, c := range byFile[id] {
+				trans = append(trans, ParatranzTranslation{Key: c.Key, Translation: c.After, Stage: c.Stage})
+			}
+
+			b, err := JSONMarshal(trans)
+			if err != nil {
+				return fmt.Errorf("JSONMarshal %s: %w", name, err)
+			}
+
+			err = retryWithBackoff(ctx, func() error {
+				return h.UpdateTranslation(ctx, id, b, name, true, true)
+			})
+			if err != nil {
+				return fmt.Errorf("UpdateTranslation %s: %w", name, err)
+			}
+			logger(ctx).Infoln("replaced", name, len(trans))
+			return nil
+		}})
+	}
+
+	return runJobs(ctx, "replace upload", jobs)
+}
+
+func printReplacePreview(w io.Writer, changes []replaceChange) {
+	files := map[string]bool{}
+	for _, c := range changes {
+		files[c.File] = true
+		fmt.Fprintf(w, "%s %s (rules %s)\n", c.File, c.Key, strings.Trim(fmt.Sprint(c.Rules), "[]"))
+		fmt.Fprintf(w, "  - %s\n", oneLine(c.Before))
+		fmt.Fprintf(w, "  + %s\n", oneLine(c.After))
+	}
+	fmt.Fprintf(w, "%d strings in %d files to change\n", len(changes), len(files))
+}
+
+// confirm asks a yes/no question on stdin, anything but y or yes is no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestReplaceRuleApply(t *testing.T) {
+	tests := []struct {
+		name string
+		rule replaceRule
+		in   string
+		want string
+	}{
+		{"literal", replaceRule{From: "Limbus", To: "邊獄"}, "Limbus Company, Limbus", "邊獄 Company, 邊獄"},
+		{"no match", replaceRule{From: "Limbus", To: "邊獄"}, "Company", "Company"},
+		{"literal keeps $", replaceRule{From: "cost", To: "$1 cost"}, "cost", "$1 cost"},
+		{"literal is not a regex", replaceRule{From: "a.c", To: "x"}, "abc a.c", "abc x"},
+		{"regex groups", replaceRule{From: `(\d+) ?HP`, To: "$1 體力", Regex: true}, "10HP and 20 HP", "10 體力 and 20 體力"},
+		{"regex empty matches skipped", replaceRule{From: `x*`, To: "-", Regex: true}, "axb", "a-b"},
+		{"word", replaceRule{From: "Sin", To: "罪", Word: true}, "Sin, Sinner, _Sin, Sin2 and Sin", "罪, Sinner, _Sin, Sin2 and 罪"},
+		{"word next to cjk", replaceRule{From: "Sin", To: "罪", Word: true}, "的Sin", "的Sin"},
+		{"word next to punctuation", replaceRule{From: "Sin", To: "罪", Word: true}, "「Sin」", "「罪」"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.rule
+			if err := r.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.apply(tt.in); got != tt.want {
+				t.Errorf("apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplaceRules(t *testing.T) {
+	dir := t.TempDir()
+
+	txt := filepath.Join(dir, "rules.txt")
+	os.WriteFile(txt, []byte("# comment\r\nLimbus|邊獄\r\n\na|b|c\n"), os.ModePerm)
+	rules, err := readReplaceRules(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].From != "Limbus" || rules[0].To != "邊獄" || rules[1].To != "b|c" || rules[1].line != 4 {
+		t.Errorf("text rules %+v, want two literal rules with their lines", rules)
+	}
+
+	js := filepath.Join(dir, "rules.json")
+	os.WriteFile(js, []byte(`[{"from": "Sin", "to": "罪", "word": true, "files": ["StoryData"], "keys": ["*->content"]}]`), os.ModePerm)
+	rules, err = readReplaceRules(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rules[0]
+	if !r.matchFile("StoryData/A.json") || r.matchFile("UI/A.json") {
+		t.Error("files glob does not scope to the folder")
+	}
+	if !r.matchKey("dataList->0->content") || r.matchKey("dataList->0->model") {
+		t.Error("keys glob does not scope to the key")
+	}
+
+	for name, data := range map[string]string{
+		"bad.txt":    "no separator\n",
+		"empty.json": `[{"from": "", "to": "x"}]`,
+		"regex.json": `[{"from": "(", "to": "x", "regex": true}]`,
+		"glob.json":  `[{"from": "a", "to": "x", "files": ["["]}]`,
+		"field.json": `[{"from": "a", "to": "x", "file": "A.json"}]`,
+	} {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte(data), os.ModePerm)
+		if _, err := readReplaceRules(p); err == nil {
+			t.Errorf("%s read, want an error", name)
+		}
+	}
+}
+
+// TestReplaceFromFile applies the rules in order and keeps the stages.
+func TestReplaceFromFile(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() { replaceYes = false }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+
+	id := srv.AddFile(1, "StoryData/A.json", []paratranztest.String{
+		{Key: "a", Original: "x", Translation: "Limbus 公司", Stage: stageReviewed},
+		{Key: "b", Original: "y", Translation: "別的", Stage: stageTranslated},
+	})
+	os.WriteFile("rules.txt", []byte("Limbus|邊獄\n邊獄 公司|邊獄公司\n"), os.ModePerm)
+
+	replaceYes = true
+	if err := replaceFromFile(context.Background(), "rules.txt"); err != nil {
+		t.Fatal(err)
+	}
+	strs := stringsByKey(srv.Strings(1, id))
+	if got := strs["a"]; got.Translation != "邊獄公司" || got.Stage != stageReviewed {
+		t.Errorf("replaced string %+v, want both rules in order and the stage kept", got)
+	}
+	if got := strs["b"]; got.Translation != "別的" {
+		t.Errorf("string without a match %+v, want it unchanged", got)
+	}
+}
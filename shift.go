@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// shiftWindow is how many positions away from its own a string looks for a
+// fuzzy match.
+const shiftWindow = 50
+
+var shiftThreshold = 0.85
+
+// shiftMatch is a translation restored onto a string whose original is
+// similar but not identical to the one it was made for.
+type shiftMatch struct {
+	Key         string  `json:"key"`
+	FromKey     string  `json:"fromKey"`
+	Similarity  float64 `json:"similarity"`
+	Original    string  `json:"original"`
+	OldOriginal string  `json:"oldOriginal"`
+}
+
+type fileShift struct {
+	File  string                 `json:"file"`
+	Exact int                    `json:"exact"`
+	Fuzzy []shiftMatch           `json:"fuzzy,omitempty"`
+	Lost  []ParatranzTranslation `json:"lost,omitempty"`
+}
+
+// shiftReport collects the shift fixes of every file of a run.
+var shiftReport = struct {
+	mu    sync.Mutex
+	files []fileShift
+}{}
+
+func addShiftReport(fs fileShift) {
+	shiftReport.mu.Lock()
+	defer shiftReport.mu.Unlock()
+	shiftReport.files = append(shiftReport.files, fs)
+}
+
+// writeShiftReport saves the collected fixes to dump/shift_report.json.
+func writeShiftReport() error {
+	shiftReport.mu.Lock()
+	defer shiftReport.mu.Unlock()
+
+	if len(shiftReport.files) == 0 {
+		return nil
+	}
+
+	sort.Slice(shiftReport.files, func(i, j int) bool { return shiftReport.files[i].File < shiftReport.files[j].File })
+
+	report := struct {
+		Threshold float64     `json:"threshold"`
+		Exact     int         `json:"exact"`
+		Fuzzy     int         `json:"fuzzy"`
+		Lost      int         `json:"lost"`
+		Files     []fileShift `json:"files"`
+	}{Threshold: shiftThreshold, Files: shiftReport.files}
+	for _, f := range shiftReport.files {
+		report.Exact += f.Exact
+		report.Fuzzy += len(f.Fuzzy)
+		report.Lost += len(f.Lost)
+	}
+
+	b, err := JSONMarshal(report)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal shift report: %w", err)
+	}
+
+	p := cfg.dumpPath("shift_report.json")
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err := os.WriteFile(p, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write shift report: %w", err)
+	}
+
+	zap.S().Infow("shift report written", "path", p, "exact", report.Exact, "fuzzy", report.Fuzzy, "lost", report.Lost)
+	return nil
+}
+
+func isForcedKey(key string) bool {
+	return strings.HasSuffix(key, "->id") || strings.HasSuffix(key, "->model")
+}
+
+// fixFileShift gives translations lost by the upload back to the strings
+// they moved to. An identical original anywhere in the file restores the
+// translation with its stage. Otherwise an original within shiftWindow positions
+// whose normalised text is at least shiftThreshold similar restores it as
+// translated but unreviewed, with the old original noted in the context.
+func fixFileShift(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, oldtrans []ParatranzTranslation, tranfolder, tranname string) error {
+	logger(ctx).Infoln("fixFileShift", pf.ID, tranfolder, tranname)
+
+	report, err := recoverShift(ctx, h, pf, oldtrans)
+	if err != nil {
+		return err
+	}
+	if report.Exact > 0 || len(report.Fuzzy) > 0 || len(report.Lost) > 0 {
+		addShiftReport(report)
+	}
+	if len(report.Lost) > 0 {
+		logger(ctx).Warnw("translations lost by the update", "file", pf.Name, "count", len(report.Lost))
+	}
+	return nil
+}
+
+// recoverShift writes the matches of fixFileShift and reports them with the
+// old translations nothing took.
+func recoverShift(ctx context.Context, h *ParatranzHandler, pf ParatranzFile, oldtrans []ParatranzTranslation) (fileShift, error) {
+	m := map[string]ParatranzTranslation{}
+
+	// old translations by position, forced keys never move
+	olds := []ParatranzTranslation{}
+	for _, t := range oldtrans {
+		if !isForcedKey(t.Key) && t.Stage != 0 && t.Translation != "" {
+			m[t.Original] = t
+			olds = append(olds, t)
+		}
+	}
+
+	var newtrans []ParatranzTranslation
+
+	err := retryWithBackoff(ctx, func() error {
+		trans, err := h.GetTranslation(ctx, pf.ID)
+		newtrans = trans
+		return err
+	})
+
+	if err != nil {
+		return fileShift{}, fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	report := fileShift{File: pf.Name}
+
+	// translations paratranz kept because key and original did not change
+	kept := map[string]bool{}
+	for _, t := range newtrans {
+		kept[t.Key+"\x00"+t.Original] = true
+	}
+
+	oldPos := map[string]int{}
+	for i, t := range oldtrans {
+		oldPos[t.Key] = i
+	}
+
+	restored := map[string]bool{}
+	taken := map[string]bool{}
+	fixtrans := []ParatranzTranslation{}
+	fuzzy := []ParatranzTranslation{}
+
+	// exact matches first, so the fuzzy pass never hands out an old
+	// translation an identical original gets back anyway
+	lost := []int{}
+	for pos, t := range newtrans {
+		if t.Stage != 0 || isForcedKey(t.Key) {
+			continue
+		}
+
+		if o, match := m[t.Original]; match {
+			t.Translation = o.Translation
+			t.Stage = o.Stage
+			fixtrans = append(fixtrans, t)
+			restored[t.Original] = true
+			continue
+		}
+		lost = append(lost, pos)
+	}
+
+	for _, pos := range lost {
+		t := newtrans[pos]
+
+		best, score := -1, 0.0
+		norm := normalizeShift(t.Original)
+		for i, o := range olds {
+			if taken[o.Key] || restored[o.Original] || kept[o.Key+"\x00"+o.Original] {
+				continue
+			}
+			if d := oldPos[o.Key] - pos; d > shiftWindow || d < -shiftWindow {
+				continue
+			}
+			s := similarity(norm, normalizeShift(o.Original))
+			if s >= shiftThreshold && s > score {
+				best, score = i, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+
+		o := olds[best]
+		taken[o.Key] = true
+		t.Translation = o.Translation
+		t.Stage = stageTranslated
+		t.Context = strings.TrimSuffix(fmt.Sprintf("Translation restored from a %.0f%% similar original:\n%s\n\n%s", score*100, o.Original, t.Context), "\n\n")
+		fuzzy = append(fuzzy, t)
+		report.Fuzzy = append(report.Fuzzy, shiftMatch{Key: t.Key, FromKey: o.Key, Similarity: score, Original: t.Original, OldOriginal: o.Original})
+	}
+
+	report.Exact = len(fixtrans)
+	for _, o := range olds {
+		if !kept[o.Key+"\x00"+o.Original] && !restored[o.Original] && !taken[o.Key] {
+			report.Lost = append(report.Lost, o)
+		}
+	}
+
+	if len(fixtrans) > 0 {
+		logger(ctx).Infow("fix shift", "count", len(fixtrans))
+
+		b, err := JSONMarshal(fixtrans)
+		if err != nil {
+			return report, fmt.Errorf("JSONMarshal %s: %w", pf.Name, err)
+		}
+
+		err = retryWithBackoff(ctx, func() error {
+			return h.UpdateTranslation(ctx, pf.ID, b, pf.Name, true, true)
+		})
+
+		if err != nil {
+			return report, fmt.Errorf("UpdateTranslation %s: %w", pf.Name, err)
+		}
+	}
+
+	if len(fuzzy) > 0 {
+		logger(ctx).Infow("fix shift fuzzy", "count", len(fuzzy))
+	}
+
+	for _, t := range fuzzy {
+		str := ParatranzString{Key: t.Key, Translation: &t.Translation, Stage: &t.Stage, Context: &t.Context}
+		err := retryWithBackoff(ctx, func() error {
+			return h.UpdateString(ctx, pf.ID, t.ID, str)
+		})
+		if err != nil {
+			return report, fmt.Errorf("UpdateString %s %s: %w", pf.Name, t.Key, err)
+		}
+	}
+
+	return report, nil
+}
+
+// normalizeShift drops whitespace and punctuation and folds case, so edits
+// to those alone do not count as differences.
+func normalizeShift(s string) []rune {
+	out := []rune{}
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			continue
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return out
+}
+
+// similarity is one minus the levenshtein distance relative to the longer
+// text.
+func similarity(a, b []rune) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	longer := max(len(a), len(b))
+	// the distance is at least the difference in length
+	if 1-float64(longer-min(len(a), len(b)))/float64(longer) < shiftThreshold {
+		return 0
+	}
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return 1 - float64(prev[len(b)])/float64(longer)
+}
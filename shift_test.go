@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 0},
+		{"abc", "", 0},
+		{"abcdefghij", "abcdefghij", 1},
+		{"abcdefghij", "abcdefghiX", 0.9},
+		{"abcdefghij", "abcdefghi", 0.9},
+		{"abcdefghij", "Xbcdefghijk", 9.0 / 11},
+		// a length difference alone below the threshold skips the distance
+		{"abcdefghij", "abcde", 0},
+		{"안녕하세요 세계", "안녕하세요 세상", 6.0 / 7},
+		// normalised, whitespace, punctuation and case do not count
+		{"Hello, World!", "hello world", 1},
+	}
+
+	for _, tt := range tests {
+		got := similarity(normalizeShift(tt.a), normalizeShift(tt.b))
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFixFileShift(t *testing.T) {
+	defer func() { shiftReport.files = nil }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	h := newParatranzHandler(paraid)
+	ctx := context.Background()
+
+	// an entry was inserted on top and the second one edited
+	id := srv.AddFile(1, "StoryData/Test.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "새로운"},
+		{Key: "dataList->1->content", Original: "안녕하세요 세계"},
+		{Key: "dataList->2->content", Original: "오늘은 날씨가 좋습니다요"},
+		{Key: "dataList->3->content", Original: "안녕하세요 세계요"},
+	})
+	oldtrans := []ParatranzTranslation{
+		{Key: "dataList->0->content", Original: "안녕하세요 세계", Translation: "你好世界", Stage: stageReviewed},
+		{Key: "dataList->1->content", Original: "오늘은 날씨가 좋습니다", Translation: "今天天气很好", Stage: stageReviewed},
+	}
+	files, err := h.GetFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fixFileShift(ctx, h, files["StoryData/Test.json"], oldtrans, "StoryData", "Test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	strs := srv.Strings(1, id)
+	if got := strs[1]; got.Translation != "你好世界" || got.Stage != stageReviewed {
+		t.Errorf("exact match %+v, want the translation with its reviewed stage", got)
+	}
+	if got := strs[2]; got.Translation != "今天天气很好" || got.Stage != stageTranslated || !strings.Contains(got.Context, "오늘은 날씨가 좋습니다") {
+		t.Errorf("fuzzy match %+v, want the translation unreviewed with the old original in the context", got)
+	}
+	if got := strs[3]; got.Translation != "" {
+		t.Errorf("string %+v got a translation an exact match already took back", got)
+	}
+	if got := strs[0]; got.Translation != "" {
+		t.Errorf("new string %+v, want it untranslated", got)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var rollbackForce = false
+
+// currentRun is the snapshot of the running command, nil for commands that
+// do not write to paratranz and for dry runs.
+var currentRun *runSnapshot
+
+// runFinishTimeout bounds the after snapshot, which also runs once the run
+// was interrupted.
+const runFinishTimeout = 2 * time.Minute
+
+// runSnapshot keeps the translations of every file a run writes to as they
+// were before its first write, and as they were when it ended, in
+// dump/runs/<run>/. rollback puts the first ones back.
+type runSnapshot struct {
+	mu    sync.Mutex
+	dir   string
+	locks map[string]*sync.Mutex
+	names map[int]map[int]string
+
+	ID         string          `json:"id"`
+	Command    string          `json:"command"`
+	Args       []string        `json:"args"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Files      []*snapshotFile `json:"files"`
+}
+
+type snapshotFile struct {
+	Project int    `json:"project"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Strings int    `json:"strings"`
+	Created bool   `json:"created,omitempty"`
+	After   bool   `json:"after,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+func (f *snapshotFile) base() string {
+	return strconv.Itoa(f.Project) + "-" + strconv.Itoa(f.ID) + ".json"
+}
+
+func runDir(id string) string {
+	return cfg.dumpPath("runs", id)
+}
+
+func newRunSnapshot(command string, args []string) *runSnapshot {
+	now := time.Now()
+	id := now.Format("20060102-150405") + "-" + command
+	return &runSnapshot{
+		dir:       runDir(id),
+		locks:     map[string]*sync.Mutex{},
+		names:     map[int]map[int]string{},
+		ID:        id,
+		Command:   command,
+		Args:      redactToken(args),
+		StartedAt: now,
+	}
+}
+
+// redactToken hides the value of -token so run.json can be shared.
+func redactToken(args []string) []string {
+	out := make([]string, len(args))
+	hide := false
+	for i, a := range args {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		switch {
+		case hide:
+			out[i] = "***"
+			hide = false
+		case strings.HasPrefix(a, "-") && name == "token" && hasValue:
+			out[i] = a[:strings.Index(a, "=")+1] + "***"
+		case strings.HasPrefix(a, "-") && name == "token":
+			out[i] = a
+			hide = true
+		default:
+			out[i] = a
+		}
+	}
+	return out
+}
+
+// WithSnapshot makes the handler save the translations of a file to s before
+// the first request of the run that changes it.
+func WithSnapshot(s *runSnapshot) ParatranzOption {
+	return func(h *ParatranzHandler) {
+		h.snapshot = s
+	}
+}
+
+// snapshotFile is called before every write to a file.
+func (h *ParatranzHandler) snapshotFile(ctx context.Context, id int) error {
+	if h.snapshot == nil || h.readOnly {
+		return nil
+	}
+	return h.snapshot.take(ctx, h, id)
+}
+
+func (s *runSnapshot) take(ctx context.Context, h *ParatranzHandler, id int) error {
+	key := strconv.Itoa(h.id) + "-" + strconv.Itoa(id)
+
+	s.mu.Lock()
+	lock, has := s.locks[key]
+	if !has {
+		lock = &sync.Mutex{}
+		s.locks[key] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if s.file(h.id, id) != nil {
+		return nil
+	}
+
+	trans, err := h.GetTranslation(ctx, id)
+	if err != nil {
+		return fmt.Errorf("snapshot file %d: %w", id, err)
+	}
+	name, err := s.fileName(ctx, h, id)
+	if err != nil {
+		return fmt.Errorf("snapshot file %d: %w", id, err)
+	}
+
+	f := &snapshotFile{Project: h.id, ID: id, Name: name, Strings: len(trans)}
+	if err := s.write("before", f, trans); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.Files = append(s.Files, f)
+	s.mu.Unlock()
+	return s.save()
+}
+
+// recordUpload notes a file the run created, it has nothing to snapshot and
+// rollback deletes it.
+func (h *ParatranzHandler) recordUpload(pf ParatranzFile) error {
+	if h.snapshot == nil || h.readOnly {
+		return nil
+	}
+
+	s := h.snapshot
+	s.mu.Lock()
+	s.Files = append(s.Files, &snapshotFile{Project: h.id, ID: pf.ID, Name: pf.Name, Created: true})
+	s.mu.Unlock()
+	return s.save()
+}
+
+func (s *runSnapshot) file(project, id int) *snapshotFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.Files {
+		if f.Project == project && f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// fileName looks the id up in the file list of the project, fetched again
+// when the file was created after the last fetch.
+func (s *runSnapshot) fileName(ctx context.Context, h *ParatranzHandler, id int) (string, error) {
+	s.mu.Lock()
+	name, has := s.names[h.id][id]
+	s.mu.Unlock()
+	if has {
+		return name, nil
+	}
+
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := map[int]string{}
+	for _, f := range m {
+		names[f.ID] = f.Name
+	}
+	s.names[h.id] = names
+	return names[id], nil
+}
+
+func (s *runSnapshot) write(stage string, f *snapshotFile, trans []ParatranzTranslation) error {
+	b, err := JSONMarshal(trans)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal snapshot %s: %w", f.Name, err)
+	}
+
+	p := filepath.Join(s.dir, stage, f.base())
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err := os.WriteFile(p, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write snapshot %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+func (s *runSnapshot) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := JSONMarshal(s)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal run: %w", err)
+	}
+
+	p := filepath.Join(s.dir, "run.json")
+	os.MkdirAll(s.dir, os.ModePerm)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write run: %w", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+// finish records the state every snapshotted file was left in, rollback
+// then leaves strings edited after the run alone. The run only counts as
+// finished once every file has its after snapshot.
+func (s *runSnapshot) finish(ctx context.Context) {
+	if len(s.Files) == 0 {
+		return
+	}
+
+	complete := true
+	handlers := map[int]*ParatranzHandler{}
+	for _, f := range s.Files {
+		if ctx.Err() != nil {
+			complete = false
+			break
+		}
+
+		h, has := handlers[f.Project]
+		if !has {
+			h = newParatranzHandler(f.Project)
+			handlers[f.Project] = h
+		}
+
+		var trans []ParatranzTranslation
+		err := retryWithBackoff(ctx, func() error {
+			t, err := h.GetTranslation(ctx, f.ID)
+			trans = t
+			return err
+		})
+		switch {
+		case errors.Is(err, ErrNotFound):
+			f.Deleted = true
+		case err != nil:
+			zap.S().Warnw("snapshot after the run failed", "file", f.Name, "error", err)
+			complete = false
+		default:
+			if err := s.write("after", f, trans); err != nil {
+				zap.S().Warnln(err)
+				complete = false
+				continue
+			}
+			f.After = true
+		}
+	}
+
+	if complete {
+		now := time.Now()
+		s.FinishedAt = &now
+	} else {
+		zap.S().Warnw("run snapshot incomplete, rollback restores strings edited since the run too", "run", s.ID)
+	}
+	if err := s.save(); err != nil {
+		zap.S().Warnln(err)
+		return
+	}
+	zap.S().Infow("run snapshot written, undo it with rollback", "run", s.ID, "files", len(s.Files), "path", s.dir)
+}
+
+func readSnapshot(dir, stage string, f *snapshotFile) ([]ParatranzTranslation, error) {
+	b, err := os.ReadFile(filepath.Join(dir, stage, f.base()))
+	if err != nil {
+		return nil, err
+	}
+	trans := []ParatranzTranslation{}
+	if err := json.Unmarshal(b, &trans); err != nil {
+		return nil, fmt.Errorf("read snapshot %s: %w", f.Name, err)
+	}
+	return trans, nil
+}
+
+// rollback puts the translations and stages of every file a run changed
+// back to the snapshot from before the run and deletes the files it
+// created. Strings edited since the run ended are kept unless rollbackForce
+// is set.
+func rollback(ctx context.Context, runID string) error {
+	dir := runDir(runID)
+	b, err := os.ReadFile(filepath.Join(dir, "run.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: no run %s in %s", errUsage, runID, filepath.Dir(dir))
+		}
+		return err
+	}
+
+	run := runSnapshot{}
+	if err := json.Unmarshal(b, &run); err != nil {
+		return fmt.Errorf("read run %s: %w", runID, err)
+	}
+
+	zap.S().Infow("Start rollback", "run", runID, "command", run.Command, "started", run.StartedAt, "files", len(run.Files))
+	if run.FinishedAt == nil {
+		zap.S().Warnln("the run did not finish, strings edited since it stopped are restored too")
+	}
+
+	handlers := map[int]*ParatranzHandler{}
+	jobs := []fileJob{}
+	for _, f := range run.Files {
+		if f.Deleted {
+			zap.S().Warnw("file deleted by the run, bring it back with restore-deleted", "file", f.Name)
+			continue
+		}
+
+		h, has := handlers[f.Project]
+		if !has {
+			h = newParatranzHandler(f.Project)
+			handlers[f.Project] = h
+		}
+
+		jobs = append(jobs, fileJob{name: f.Name, run: func(ctx context.Context) error {
+			if f.Created {
+				return rollbackCreated(ctx, h, dir, f)
+			}
+			return rollbackFile(ctx, h, dir, f)
+		}})
+	}
+
+	return runJobs(ctx, "rollback", jobs)
+}
+
+func rollbackFile(ctx context.Context, h *ParatranzHandler, dir string, f *snapshotFile) error {
+	before, err := readSnapshot(dir, "before", f)
+	if err != nil {
+		return err
+	}
+
+	after := map[string]ParatranzTranslation{}
+	if f.After {
+		trans, err := readSnapshot(dir, "after", f)
+		if err != nil {
+			return err
+		}
+		for _, t := range trans {
+			after[t.Key] = t
+		}
+	}
+
+	var current []ParatranzTranslation
+	err = retryWithBackoff(ctx, func() error {
+		t, err := h.GetTranslation(ctx, f.ID)
+		current = t
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		logger(ctx).Warnw("file no longer exists", "file", f.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", f.Name, f.ID, err)
+	}
+
+	now := map[string]ParatranzTranslation{}
+	for _, t := range current {
+		now[t.Key] = t
+	}
+
+	restore := []ParatranzTranslation{}
+	recreate := []ParatranzTranslation{}
+	kept := 0
+	for _, t := range before {
+		cur, has := now[t.Key]
+		if has && cur.Translation == t.Translation && cur.Stage == t.Stage {
+			continue
+		}
+
+		// a string the run deleted is missing from the after snapshot too
+		if a, inAfter := after[t.Key]; f.After && !rollbackForce && (has != inAfter || has && (a.Translation != cur.Translation || a.Stage != cur.Stage)) {
+			kept++
+			logger(ctx).Debugw("keep string edited after the run", "file", f.Name, "key", t.Key)
+			continue
+		}
+		if !has {
+			recreate = append(recreate, t)
+			continue
+		}
+		restore = append(restore, ParatranzTranslation{Key: t.Key, Translation: t.Translation, Stage: t.Stage})
+	}
+
+	logger(ctx).Infow("rollback", "file", f.Name, "restore", len(restore), "recreate", len(recreate), "editedSince", kept)
+	if dryRun {
+		return nil
+	}
+
+	if len(restore) > 0 {
+		tb, err := JSONMarshal(restore)
+		if err != nil {
+			return fmt.Errorf("JSONMarshal %s: %w", f.Name, err)
+		}
+
+		err = retryWithBackoff(ctx, func() error {
+			return h.UpdateTranslation(ctx, f.ID, tb, f.Name, true, true)
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateTranslation %s: %w", f.Name, err)
+		}
+	}
+
+	for _, t := range recreate {
+		str := ParatranzString{Key: t.Key, File: &f.ID, Original: ptr(t.Original), Translation: ptr(t.Translation), Stage: ptr(t.Stage), Context: ptr(t.Context)}
+		err := retryWithBackoff(ctx, func() error {
+			_, err := h.CreateString(ctx, str)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("CreateString %s %s: %w", f.Name, t.Key, err)
+		}
+	}
+	return nil
+}
+
+// rollbackCreated deletes a file the run uploaded, archived like any other
+// delete. A file edited since the run is kept unless rollbackForce is set.
+func rollbackCreated(ctx context.Context, h *ParatranzHandler, dir string, f *snapshotFile) error {
+	var current []ParatranzTranslation
+	err := retryWithBackoff(ctx, func() error {
+		t, err := h.GetTranslation(ctx, f.ID)
+		current = t
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		logger(ctx).Warnw("file no longer exists", "file", f.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", f.Name, f.ID, err)
+	}
+
+	if f.After && !rollbackForce {
+		after, err := readSnapshot(dir, "after", f)
+		if err != nil {
+			return err
+		}
+		if editedSince(after, current) {
+			logger(ctx).Warnw("keep file created by the run, it was edited after the run", "file", f.Name)
+			return nil
+		}
+	}
+
+	logger(ctx).Infow("rollback", "file", f.Name, "delete", "created by the run")
+	if dryRun {
+		return nil
+	}
+	return delete(ctx, h, ParatranzFile{ID: f.ID, Name: f.Name})
+}
+
+// editedSince reports whether any string differs between the two states.
+func editedSince(after, current []ParatranzTranslation) bool {
+	if len(after) != len(current) {
+		return true
+	}
+	was := map[string]ParatranzTranslation{}
+	for _, t := range after {
+		was[t.Key] = t
+	}
+	for _, t := range current {
+		a, has := was[t.Key]
+		if !has || a.Translation != t.Translation || a.Stage != t.Stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestRedactToken(t *testing.T) {
+	got := redactToken([]string{"-id", "1", "-token", "secret", "--token=secret", "-tokens", "x"})
+	want := []string{"-id", "1", "-token", "***", "--token=***", "-tokens", "x"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("redactToken = %v, want %v", got, want)
+		}
+	}
+}
+
+// TestRollback snapshots a replace run and puts its translations back,
+// keeping a string edited since unless forced.
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	writeConfig(t, "paratranz.json", map[string]any{})
+
+	id := srv.AddFile(1, "StoryData/A.json", []paratranztest.String{
+		{Key: "a", Original: "x", Translation: "Limbus 公司", Stage: stageReviewed},
+		{Key: "b", Original: "y", Translation: "Limbus", Stage: stageTranslated},
+		{Key: "c", Original: "z", Translation: "別的", Stage: stageTranslated},
+	})
+	os.WriteFile("rules.txt", []byte("Limbus|邊獄\n"), os.ModePerm)
+	runCommand(t, srv, "paratranz.json", "replace", "-file", "rules.txt", "-yes")
+
+	runs, _ := os.ReadDir(filepath.Join("dump", "runs"))
+	if len(runs) != 1 {
+		t.Fatalf("runs %v, want one snapshot", runs)
+	}
+	runID := runs[0].Name()
+	run := runSnapshot{}
+	b, _ := os.ReadFile(filepath.Join("dump", "runs", runID, "run.json"))
+	if err := json.Unmarshal(b, &run); err != nil {
+		t.Fatal(err)
+	}
+	if run.FinishedAt == nil || len(run.Files) != 1 || run.Files[0].Name != "StoryData/A.json" || !run.Files[0].After {
+		t.Fatalf("run files %+v finished %v, want the file snapshotted before and after", run.Files, run.FinishedAt)
+	}
+
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	tb, _ := JSONMarshal([]ParatranzTranslation{{Key: "b", Translation: "手改", Stage: stageTranslated}})
+	if err := newParatranzHandler(1).UpdateTranslation(context.Background(), id, tb, "StoryData/A.json", true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	runCommand(t, srv, "paratranz.json", "rollback", runID)
+	strs := stringsByKey(srv.Strings(1, id))
+	if got := strs["a"]; got.Translation != "Limbus 公司" || got.Stage != stageReviewed {
+		t.Errorf("rolled back string %+v, want the translation before the run", got)
+	}
+	if got := strs["b"]; got.Translation != "手改" {
+		t.Errorf("string edited since the run %+v, want it kept", got)
+	}
+
+	runCommand(t, srv, "paratranz.json", "rollback", "-force", runID)
+	if got := stringsByKey(srv.Strings(1, id))["b"]; got.Translation != "Limbus" {
+		t.Errorf("string edited since the run %+v after -force, want the translation before the run", got)
+	}
+}
+
+func TestStringWritesSnapshotTheirFile(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	id := srv.AddFile(1, "StoryData/A.json", []paratranztest.String{{Key: "a", Original: "x", Translation: "一", Stage: stageTranslated}})
+	other := srv.AddFile(1, "StoryData/B.json", []paratranztest.String{{Key: "b", Original: "y"}})
+
+	s := newRunSnapshot("test", nil)
+	h := NewParatranzHandler(1, "token", WithAPIRoot(srv.APIRoot()), WithRateLimit(0, 0), WithSnapshot(s))
+	ctx := context.Background()
+	a := srv.Strings(1, id)[0]
+	if err := h.UpdateString(ctx, id, a.ID, ParatranzString{Key: "a", Translation: ptr("二")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.DeleteString(ctx, other, srv.Strings(1, other)[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Files) != 2 || s.Files[0].ID != id || s.Files[1].ID != other {
+		t.Fatalf("snapshotted %+v, want both files", s.Files)
+	}
+	before, err := readSnapshot(s.dir, "before", s.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 1 || before[0].Translation != "一" {
+		t.Errorf("snapshot %+v, want the translation before the update", before)
+	}
+}
+
+// TestRollbackCreatesAndDeletes rolls back a sync that removed a string and
+// created a file.
+func TestRollbackCreatesAndDeletes(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() { incrementalSync = false }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	writeConfig(t, "paratranz.json", map[string]any{"keyStrategy": keyByID})
+
+	id := srv.AddFile(1, "StoryData/Test.json", []paratranztest.String{
+		{Key: "dataList->[id=1]->content", Original: "하나", Translation: "一", Stage: stageReviewed, Context: "EN:\nOne"},
+		{Key: "dataList->[id=2]->content", Original: "둘", Translation: "二", Stage: stageReviewed, Context: "EN:\nTwo"},
+	})
+	writeAsset(t, "Assets", "kr", "Test.json", "하나")
+	writeAsset(t, "Assets", "kr", "New.json", "새")
+	os.MkdirAll("dump", os.ModePerm)
+	list := "M\tkr/StoryData/KR_Test.json\nA\tkr/StoryData/KR_New.json\n"
+	if err := os.WriteFile(filepath.Join("dump", "kr_files.txt"), []byte(list), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	runCommand(t, srv, "paratranz.json", "sync", "-from-lists", "-incremental")
+
+	if _, has := stringsByKey(srv.Strings(1, id))["dataList->[id=2]->content"]; has {
+		t.Fatal("sync kept the removed string")
+	}
+	if _, has := srv.Files(1)["StoryData/New.json"]; !has {
+		t.Fatal("sync did not create the new file")
+	}
+
+	runs, _ := os.ReadDir(filepath.Join("dump", "runs"))
+	if len(runs) != 1 {
+		t.Fatalf("runs %v, want one snapshot", runs)
+	}
+	runCommand(t, srv, "paratranz.json", "rollback", runs[0].Name())
+
+	got, has := stringsByKey(srv.Strings(1, id))["dataList->[id=2]->content"]
+	if !has || got.Original != "둘" || got.Translation != "二" || got.Stage != stageReviewed || got.Context != "EN:\nTwo" {
+		t.Errorf("removed string after the rollback %+v, want it created again as it was", got)
+	}
+	if _, has := srv.Files(1)["StoryData/New.json"]; has {
+		t.Error("file created by the run left after the rollback")
+	}
+	if _, err := latestArchive("StoryData/New.json"); err != nil {
+		t.Errorf("created file deleted without an archive: %v", err)
+	}
+}
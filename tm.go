@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	tmFromArtifact = false
+	tmText         = ""
+	tmContains     = false
+	applyTM        = false
+	tmStage        = stageTranslated
+)
+
+const stepTM = "tm"
+
+// tmEntry is one translation seen for an original, with how often and at
+// which best stage.
+type tmEntry struct {
+	Translation string `json:"translation"`
+	Stage       int    `json:"stage"`
+	Count       int    `json:"count"`
+	Source      string `json:"source"`
+	File        string `json:"file"`
+	Key         string `json:"key"`
+}
+
+// translationMemory maps every translated original to its translations,
+// best first. A translation is kept once per source it was built from, like
+// the api or the artifact of a project. It is kept in dump/tm.json.
+type translationMemory struct {
+	mu     sync.Mutex
+	source string
+
+	BuiltAt time.Time             `json:"builtAt"`
+	Sources map[string]time.Time  `json:"sources"`
+	Entries map[string][]*tmEntry `json:"entries"`
+}
+
+func tmPath() string {
+	return cfg.dumpPath("tm.json")
+}
+
+func newTranslationMemory(source string) *translationMemory {
+	now := time.Now()
+	return &translationMemory{source: source, BuiltAt: now, Sources: map[string]time.Time{source: now}, Entries: map[string][]*tmEntry{}}
+}
+
+// add records the translations of a file. Forced keys, disputed strings and
+// strings nobody translated are left out.
+func (tm *translationMemory) add(file string, trans []ParatranzTranslation) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	for _, t := range trans {
+		if t.Original == "" || t.Translation == "" || isForcedKey(t.Key) {
+			continue
+		}
+		if t.Stage < stageTranslated || t.Stage == stageDisputed {
+			continue
+		}
+
+		found := false
+		for _, e := range tm.Entries[t.Original] {
+			if e.Source == tm.source && e.Translation == t.Translation {
+				e.Count++
+				e.Stage = max(e.Stage, t.Stage)
+				found = true
+				break
+			}
+		}
+		if !found {
+			tm.Entries[t.Original] = append(tm.Entries[t.Original], &tmEntry{Translation: t.Translation, Stage: t.Stage, Count: 1, Source: tm.source, File: file, Key: t.Key})
+		}
+	}
+}
+
+// merge replaces the entries of the sources other was built from with its
+// own and keeps those of every other source.
+func (tm *translationMemory) merge(other *translationMemory) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	merged := map[string][]*tmEntry{}
+	for original, entries := range tm.Entries {
+		for _, e := range entries {
+			if _, rebuilt := other.Sources[e.Source]; !rebuilt {
+				merged[original] = append(merged[original], e)
+			}
+		}
+	}
+	for original, entries := range other.Entries {
+		merged[original] = append(merged[original], entries...)
+	}
+	tm.Entries = merged
+	for source, at := range other.Sources {
+		tm.Sources[source] = at
+	}
+	tm.BuiltAt = other.BuiltAt
+}
+
+// sort orders the translations of every original by stage, then by use.
+func (tm *translationMemory) sort() {
+	for _, entries := range tm.Entries {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].Stage != entries[j].Stage {
+				return entries[i].Stage > entries[j].Stage
+			}
+			return entries[i].Count > entries[j].Count
+		})
+	}
+}
+
+// best is the translation to reuse for original, nil without one.
+func (tm *translationMemory) best(original string) *tmEntry {
+	if entries := tm.Entries[original]; len(entries) > 0 {
+		return entries[0]
+	}
+	return nil
+}
+
+func (tm *translationMemory) save() error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.sort()
+	b, err := JSONMarshal(tm)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal translation memory: %w", err)
+	}
+
+	p := tmPath()
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write translation memory: %w", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+func loadTranslationMemory() (*translationMemory, error) {
+	p := tmPath()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no translation memory at %s, run tm-build first", p)
+		}
+		return nil, err
+	}
+
+	tm := &translationMemory{}
+	if err := json.Unmarshal(b, tm); err != nil {
+		return nil, fmt.Errorf("read translation memory %s: %w", p, err)
+	}
+	if tm.Entries == nil {
+		tm.Entries = map[string][]*tmEntry{}
+	}
+	if tm.Sources == nil {
+		tm.Sources = map[string]time.Time{}
+	}
+	return tm, nil
+}
+
+var loadedTM = struct {
+	once sync.Once
+	tm   *translationMemory
+	err  error
+}{}
+
+// sharedTM loads the translation memory once for all jobs of a run.
+func sharedTM() (*translationMemory, error) {
+	loadedTM.once.Do(func() {
+		loadedTM.tm, loadedTM.err = loadTranslationMemory()
+	})
+	return loadedTM.tm, loadedTM.err
+}
+
+// buildTM adds the current translations of the project, or of its
+// downloaded artifact, to dump/tm.json. What an earlier build from the same
+// source added is replaced, other sources are kept.
+func buildTM(ctx context.Context) error {
+	var (
+		tm  *translationMemory
+		err error
+	)
+	if tmFromArtifact {
+		tm, err = buildTMFromArtifact(ctx, cfg.artifactRaw(paraid))
+	} else {
+		tm, err = buildTMFromAPI(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(tmPath()); err == nil {
+		existing, err := loadTranslationMemory()
+		if err != nil {
+			return err
+		}
+		existing.merge(tm)
+		tm = existing
+	}
+
+	if err := tm.save(); err != nil {
+		return err
+	}
+
+	translations := 0
+	for _, entries := range tm.Entries {
+		translations += len(entries)
+	}
+	zap.S().Infow("translation memory written", "path", tmPath(), "sources", len(tm.Sources), "originals", len(tm.Entries), "translations", translations)
+	return nil
+}
+
+func buildTMFromAPI(ctx context.Context) (*translationMemory, error) {
+	zap.S().Infoln("Start build translation memory from project", paraid)
+
+	h := newParatranzHandler(paraid)
+	m, err := h.GetFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetFiles %d: %w", paraid, err)
+	}
+
+	tm := newTranslationMemory(fmt.Sprintf("api %d", paraid))
+
+	jobs := []fileJob{}
+	for _, f := range sortedFiles(m) {
+		jobs = append(jobs, fileJob{name: f.Name, run: func(ctx context.Context) error {
+			var trans []ParatranzTranslation
+			err := retryWithBackoff(ctx, func() error {
+				t, err := h.GetTranslation(ctx, f.ID)
+				trans = t
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("GetTranslation %s %d: %w", f.Name, f.ID, err)
+			}
+			tm.add(f.Name, trans)
+			return nil
+		}})
+	}
+
+	if err := runJobs(ctx, "tm build", jobs); err != nil {
+		return nil, err
+	}
+	return tm, nil
+}
+
+// buildTMFromArtifact reads every file of an artifact. Artifacts escape
+// html in the texts, they are stored unescaped like the api returns them.
+func buildTMFromArtifact(ctx context.Context, root string) (*translationMemory, error) {
+	zap.S().Infoln("Start build translation memory from artifact", root)
+
+	tm := newTranslationMemory("artifact " + filepath.ToSlash(root))
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		trans := []ParatranzTranslation{}
+		if err := json.Unmarshal(b, &trans); err != nil {
+			zap.S().Warnln("skip unreadable artifact file", path, err)
+			return nil
+		}
+		for i := range trans {
+			trans[i].Original = html.UnescapeString(trans[i].Original)
+			trans[i].Translation = html.UnescapeString(trans[i].Translation)
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		tm.add(filepath.ToSlash(strings.TrimSuffix(rel, ".json")), trans)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read artifact %s: %w", root, err)
+	}
+	return tm, nil
+}
+
+// queryTM prints the translations of tmText, or with tmContains of every
+// original containing it.
+func queryTM(ctx context.Context) error {
+	tm, err := loadTranslationMemory()
+	if err != nil {
+		return err
+	}
+
+	originals := []string{}
+	if tmContains {
+		for original := range tm.Entries {
+			if strings.Contains(original, tmText) {
+				originals = append(originals, original)
+			}
+		}
+		sort.Strings(originals)
+	} else if _, has := tm.Entries[tmText]; has {
+		originals = append(originals, tmText)
+	}
+
+	if len(originals) == 0 {
+		fmt.Println("no match")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORIGINAL\tTRANSLATION\tSTAGE\tCOUNT\tSOURCE\tFILE")
+	for _, original := range originals {
+		for _, e := range tm.Entries[original] {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", oneLine(original), oneLine(e.Translation), e.Stage, e.Count, e.Source, e.File+" "+e.Key)
+		}
+	}
+	return tw.Flush()
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\n", `\n`, "\t", " ").Replace(s)
+}
+
+// fillFromTM gives the untranslated strings of a new file the best
+// translation memory match of their original, at tmStage.
+func fillFromTM(ctx context.Context, h *ParatranzHandler, pf ParatranzFile) error {
+	tm, err := sharedTM()
+	if err != nil {
+		return err
+	}
+
+	var trans []ParatranzTranslation
+
+	err = retryWithBackoff(ctx, func() error {
+		t, err := h.GetTranslation(ctx, pf.ID)
+		trans = t
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("GetTranslation %s %d: %w", pf.Name, pf.ID, err)
+	}
+
+	filled := []ParatranzTranslation{}
+	for _, t := range trans {
+		if t.Stage != stageUntranslated || t.Translation != "" || isForcedKey(t.Key) {
+			continue
+		}
+		if e := tm.best(t.Original); e != nil {
+			t.Translation = e.Translation
+			t.Stage = tmStage
+			filled = append(filled, t)
+		}
+	}
+
+	logger(ctx).Infow("translation memory", "file", pf.Name, "strings", len(trans), "filled", len(filled))
+	if len(filled) == 0 {
+		return nil
+	}
+
+	b, err := JSONMarshal(filled)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal %s: %w", pf.Name, err)
+	}
+
+	err = retryWithBackoff(ctx, func() error {
+		return h.UpdateTranslation(ctx, pf.ID, b, pf.Name, true, true)
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateTranslation %s: %w", pf.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"ParatranzUploader/paratranztest"
+)
+
+func TestTranslationMemoryAdd(t *testing.T) {
+	tm := newTranslationMemory("api")
+	tm.add("A.json", []ParatranzTranslation{
+		{Key: "k1", Original: "안녕", Translation: "你好", Stage: stageTranslated},
+		{Key: "k2", Original: "안녕", Translation: "您好", Stage: stageReviewed},
+		{Key: "k3", Original: "세계", Translation: "世界", Stage: stageDisputed},
+		{Key: "k4", Original: "하늘", Translation: "", Stage: stageUntranslated},
+		{Key: "dataList->0->id", Original: "1", Translation: "1", Stage: stageTranslated},
+	})
+	tm.add("B.json", []ParatranzTranslation{
+		{Key: "k1", Original: "안녕", Translation: "你好", Stage: stageTranslated},
+		{Key: "k2", Original: "안녕", Translation: "你好", Stage: stageTranslated},
+	})
+	tm.sort()
+
+	if len(tm.Entries) != 1 {
+		t.Fatalf("entries %v, want only the translated and not disputed original", tm.Entries)
+	}
+	if e := tm.best("안녕"); e == nil || e.Translation != "您好" {
+		t.Errorf("best = %+v, want the reviewed translation over the more used one", e)
+	}
+	if entries := tm.Entries["안녕"]; len(entries) != 2 || entries[1].Count != 3 || entries[1].File != "A.json" {
+		t.Errorf("entries %+v, want 你好 counted three times from its first file", entries)
+	}
+	if tm.best("세계") != nil {
+		t.Error("disputed translation in the memory")
+	}
+}
+
+// TestApplyTM builds the memory from one file and fills a file created by a
+// sync from it.
+func TestApplyTM(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() {
+		applyTM = false
+		loadedTM.once, loadedTM.tm, loadedTM.err = sync.Once{}, nil, nil
+	}()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+	h := newParatranzHandler(paraid)
+	ctx := context.Background()
+
+	srv.AddFile(1, "StoryData/Old.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "안녕", Translation: "你好", Stage: stageReviewed},
+	})
+	if err := buildTM(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tm, err := loadTranslationMemory()
+	if err != nil || tm.best("안녕") == nil {
+		t.Fatalf("memory %+v, %v, want 안녕 in it", tm, err)
+	}
+
+	applyTM, tmStage = true, stageTranslated
+	writeAsset(t, "Assets", "kr", "New.json", "안녕", "세계")
+	if err := create(ctx, h, nil, "StoryData", "New.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	strs := stringsByKey(srv.Strings(1, srv.Files(1)["StoryData/New.json"].ID))
+	if got := strs["dataList->0->content"]; got.Translation != "你好" || got.Stage != stageTranslated {
+		t.Errorf("filled string %+v, want the memory translation at -tm-stage", got)
+	}
+	if got := strs["dataList->1->content"]; got.Translation != "" {
+		t.Errorf("string without a match %+v, want it untranslated", got)
+	}
+}
+
+// TestBuildTMMerge builds from the api and the artifact and rebuilds from
+// the api, which must not count its translations twice.
+func TestBuildTMMerge(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	defer func() { tmFromArtifact = false }()
+
+	srv := paratranztest.NewServer()
+	defer srv.Close()
+	paraid, token, apiRoot, rateLimit = 1, "test", srv.APIRoot(), 0
+	cfg = defaultConfig()
+	ctx := context.Background()
+
+	id := srv.AddFile(1, "StoryData/Test.json", []paratranztest.String{
+		{Key: "dataList->0->content", Original: "안녕", Translation: "你好", Stage: stageTranslated},
+		{Key: "dataList->1->content", Original: "세계", Translation: "世界", Stage: stageTranslated},
+	})
+	if err := buildTM(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := cfg.artifactRaw(paraid)
+	os.MkdirAll(filepath.Join(raw, "StoryData"), os.ModePerm)
+	b, _ := json.Marshal([]ParatranzTranslation{{Key: "dataList->0->content", Original: "안녕", Translation: "您好", Stage: stageReviewed}})
+	if err := os.WriteFile(filepath.Join(raw, "StoryData", "Old.json.json"), b, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	tmFromArtifact = true
+	if err := buildTM(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the api build again, with one string changed since
+	tb, _ := json.Marshal([]ParatranzTranslation{{Key: "dataList->1->content", Translation: "天下", Stage: stageTranslated}})
+	if err := newParatranzHandler(paraid).UpdateTranslation(ctx, id, tb, "StoryData/Test.json", true, true); err != nil {
+		t.Fatal(err)
+	}
+	tmFromArtifact = false
+	if err := buildTM(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err := loadTranslationMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tm.Sources) != 2 {
+		t.Errorf("sources %v, want the api and the artifact", tm.Sources)
+	}
+	if entries := tm.Entries["안녕"]; len(entries) != 2 || entries[0].Translation != "您好" || entries[1].Count != 1 {
+		t.Errorf("안녕 entries %+v, want the artifact one first and the api one counted once", entries)
+	}
+	if entries := tm.Entries["세계"]; len(entries) != 1 || entries[0].Translation != "天下" {
+		t.Errorf("세계 entries %+v, want only the current api translation", entries)
+	}
+}
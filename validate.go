@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+var validateLang = "en"
+
+// kinds of validation issues
+const (
+	issueMissingFile = "missing_file"
+	issueNoSource    = "no_source"
+	issueInvalidUTF8 = "invalid_utf8"
+	issueInvalidJSON = "invalid_json"
+	issueEntryCount  = "entry_count"
+	issueID          = "id"
+	issueField       = "field"
+	issueType        = "type"
+	issueLength      = "length"
+	issueMissingKey  = "missing_key"
+	issueExtraKey    = "extra_key"
+)
+
+type validateIssue struct {
+	File   string `json:"file"`
+	Kind   string `json:"kind"`
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type validateReport struct {
+	CheckedAt time.Time       `json:"checkedAt"`
+	Export    string          `json:"export"`
+	Files     int             `json:"files"`
+	Failed    int             `json:"failed"`
+	Issues    []validateIssue `json:"issues"`
+}
+
+// validateExport checks every file of the export against the asset it was
+// built from, the source language file or the validateLang one when there
+// is none. Only strings may differ: entry counts, ids, every other field
+// and the key set must be those of the asset with the hotfix rules
+// applied. Files in the file list of validateLang that were not exported
+// are reported too. The issues are written to dump/validate_report.json.
+func validateExport(ctx context.Context) error {
+	root := cfg.exportDir()
+	zap.S().Infoln("Start validate export", root, "lang:", validateLang)
+
+	if _, err := hotfixRules(); err != nil {
+		return err
+	}
+
+	report := validateReport{CheckedAt: time.Now(), Export: root, Issues: []validateIssue{}}
+	add := func(file, kind, path, detail string) {
+		report.Issues = append(report.Issues, validateIssue{File: file, Kind: kind, Path: path, Detail: detail})
+	}
+
+	exported := map[string]bool{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		exported[rel] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read export %s: %w", root, err)
+	}
+
+	wanted, err := validateFileList()
+	if err != nil {
+		return err
+	}
+	for _, rel := range wanted {
+		if !exported[rel] {
+			add(filepath.ToSlash(rel), issueMissingFile, "", "listed in "+cfg.fileList(validateLang))
+		}
+	}
+
+	names := []string{}
+	for rel := range exported {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+
+	for _, rel := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, issue := range validateFile(root, rel) {
+			add(filepath.ToSlash(rel), issue.Kind, issue.Path, issue.Detail)
+		}
+	}
+
+	failed := map[string]bool{}
+	for _, issue := range report.Issues {
+		failed[issue.File] = true
+	}
+	report.Files = len(names)
+	report.Failed = len(failed)
+
+	b, err := JSONMarshal(report)
+	if err != nil {
+		return fmt.Errorf("JSONMarshal validate report: %w", err)
+	}
+	p := cfg.dumpPath("validate_report.json")
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err := os.WriteFile(p, b, os.ModePerm); err != nil {
+		return fmt.Errorf("write validate report: %w", err)
+	}
+
+	if len(report.Issues) > 0 {
+		for _, issue := range report.Issues {
+			zap.S().Warnw("invalid export", "file", issue.File, "kind", issue.Kind, "path", issue.Path, "detail", issue.Detail)
+		}
+		return fmt.Errorf("export failed validation: %d issues in %d files, see %s", len(report.Issues), report.Failed, p)
+	}
+	zap.S().Infow("export is valid", "files", report.Files, "report", p)
+	return nil
+}
+
+// validateFileList is the export path of every file in the file list of
+// validateLang, none when there is no list.
+func validateFileList() ([]string, error) {
+	p := cfg.fileList(validateLang)
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		zap.S().Warnw("no file list, missing files are not checked", "path", p)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		sp := strings.Split(line, "\t")
+		if len(sp) < 2 {
+			return nil, fmt.Errorf("%s: split error: %s", p, line)
+		}
+		folder, name := getLangTranPath(sp[1], validateLang)
+		files = append(files, filepath.Join(folder, name))
+	}
+	return files, nil
+}
+
+func validateFile(root, rel string) []validateIssue {
+	issues := []validateIssue{}
+	add := func(kind, path, detail string) {
+		issues = append(issues, validateIssue{Kind: kind, Path: path, Detail: detail})
+	}
+
+	folder, name := filepath.Dir(rel), filepath.Base(rel)
+	if folder == "." {
+		folder = ""
+	}
+
+	out, err := os.ReadFile(filepath.Join(root, rel))
+	if err != nil {
+		add(issueInvalidJSON, "", err.Error())
+		return issues
+	}
+	if !utf8.Valid(out) {
+		add(issueInvalidUTF8, "", "")
+		return issues
+	}
+	outPM, err := decodePMData(out)
+	if err != nil {
+		add(issueInvalidJSON, "", err.Error())
+		return issues
+	}
+
+	sourcePath := cfg.sourcePath(folder, name)
+	src, err := os.ReadFile(sourcePath)
+	if errors.Is(err, os.ErrNotExist) {
+		sourcePath = cfg.assetPath(validateLang, folder, name)
+		src, err = os.ReadFile(sourcePath)
+	}
+	if err != nil {
+		add(issueNoSource, "", err.Error())
+		return issues
+	}
+	srcPM, err := decodePMData(src)
+	if err != nil {
+		add(issueInvalidJSON, "", "source "+sourcePath+": "+err.Error())
+		return issues
+	}
+	hotfix(zap.NewNop().Sugar(), srcPM, folder, name)
+
+	if len(outPM.DataList) != len(srcPM.DataList) {
+		add(issueEntryCount, "dataList", fmt.Sprintf("%d entries, %s has %d", len(outPM.DataList), sourcePath, len(srcPM.DataList)))
+		return issues
+	}
+
+	for i := range srcPM.DataList {
+		compareExported([]string{"dataList", strconv.Itoa(i)}, srcPM.DataList[i], outPM.DataList[i], add)
+	}
+	return issues
+}
+
+// decodePMData keeps numbers as written, so 35 and 35.0 differ.
+func decodePMData(b []byte) (*PMData, error) {
+	pm := &PMData{raw: b}
+	dec := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(b, utf8BOM)))
+	dec.UseNumber()
+	if err := dec.Decode(pm); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("data after the top-level value")
+	}
+	return pm, nil
+}
+
+// compareExported reports every difference between src and out other than
+// the text of strings. Ids must match even when they are strings.
+func compareExported(keys []string, src, out any, add func(kind, path, detail string)) {
+	path := strings.Join(keys, "->")
+	isID := keys[len(keys)-1] == "id"
+
+	switch sv := src.(type) {
+	case map[string]any:
+		ov, ok := out.(map[string]any)
+		if !ok {
+			add(issueType, path, fmt.Sprintf("object expected, got %T", out))
+			return
+		}
+		names := []string{}
+		for k := range sv {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			o, has := ov[k]
+			if !has {
+				add(issueMissingKey, path+"->"+k, "")
+				continue
+			}
+			compareExported(append(keys, k), sv[k], o, add)
+		}
+		extra := []string{}
+		for k := range ov {
+			if _, has := sv[k]; !has {
+				extra = append(extra, k)
+			}
+		}
+		sort.Strings(extra)
+		for _, k := range extra {
+			add(issueExtraKey, path+"->"+k, "")
+		}
+	case []any:
+		ov, ok := out.([]any)
+		if !ok {
+			add(issueType, path, fmt.Sprintf("array expected, got %T", out))
+			return
+		}
+		if len(ov) != len(sv) {
+			add(issueLength, path, fmt.Sprintf("%d elements, source has %d", len(ov), len(sv)))
+			return
+		}
+		for i := range sv {
+			compareExported(append(keys, strconv.Itoa(i)), sv[i], ov[i], add)
+		}
+	case string:
+		ov, ok := out.(string)
+		switch {
+		case !ok:
+			add(issueType, path, fmt.Sprintf("string expected, got %T", out))
+		case isID && ov != sv:
+			add(issueID, path, fmt.Sprintf("%q, source has %q", ov, sv))
+		}
+	default:
+		if fmt.Sprint(src) == fmt.Sprint(out) && fmt.Sprintf("%T", src) == fmt.Sprintf("%T", out) {
+			return
+		}
+		kind := issueField
+		if isID {
+			kind = issueID
+		}
+		add(kind, path, fmt.Sprintf("%v, source has %v", out, src))
+	}
+}
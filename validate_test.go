@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	cfg = defaultConfig()
+	writeAsset(t, "Assets", "kr", "Test.json", "안녕", "세계")
+	root := cfg.exportDir()
+	os.MkdirAll(filepath.Join(root, "StoryData"), os.ModePerm)
+
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{
+			name: "only strings changed",
+			out:  `{"dataList": [{"id": 1, "model": "m1", "content": "你好"}, {"id": 2, "model": "m1", "content": "世界"}]}`,
+		},
+		{
+			name: "invalid utf8",
+			out:  "{\"dataList\": [\"\xff\"]}",
+			want: []string{issueInvalidUTF8},
+		},
+		{
+			name: "invalid json",
+			out:  `{"dataList": [`,
+			want: []string{issueInvalidJSON},
+		},
+		{
+			name: "entry dropped",
+			out:  `{"dataList": [{"id": 1, "model": "m1", "content": "你好"}]}`,
+			want: []string{issueEntryCount},
+		},
+		{
+			name: "id rewritten",
+			out:  `{"dataList": [{"id": 1.0, "model": "m1", "content": "你好"}, {"id": "2", "model": "m2", "content": "世界"}]}`,
+			want: []string{issueID, issueID},
+		},
+		{
+			name: "keys changed",
+			out:  `{"dataList": [{"id": 1, "content": "你好", "extra": "x"}, {"id": 2, "model": "m2", "content": "世界"}]}`,
+			want: []string{issueMissingKey, issueExtraKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(root, "StoryData", "Test.json"), []byte(tt.out), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			issues := validateFile(root, filepath.Join("StoryData", "Test.json"))
+			if len(issues) != len(tt.want) {
+				t.Fatalf("issues %+v, want kinds %v", issues, tt.want)
+			}
+			for i, kind := range tt.want {
+				if issues[i].Kind != kind {
+					t.Errorf("issue %d %+v, want kind %s", i, issues[i], kind)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	cfg = defaultConfig()
+	writeAsset(t, "Assets", "kr", "Test.json", "안녕")
+	root := cfg.exportDir()
+	os.MkdirAll(filepath.Join(root, "StoryData"), os.ModePerm)
+	os.WriteFile(filepath.Join(root, "StoryData", "Test.json"), []byte(`{"dataList": [{"id": 1, "model": "m1", "content": "你好"}]}`), os.ModePerm)
+
+	ctx := context.Background()
+	if err := validateExport(ctx); err != nil {
+		t.Fatalf("valid export failed: %v", err)
+	}
+
+	os.MkdirAll("dump", os.ModePerm)
+	os.WriteFile(cfg.fileList("en"), []byte("M\ten/StoryData/EN_Test.json\nA\ten/StoryData/EN_Missing.json\n"), os.ModePerm)
+	if err := validateExport(ctx); err == nil {
+		t.Fatal("export missing a listed file passed")
+	}
+
+	report := validateReport{}
+	b, _ := os.ReadFile(cfg.dumpPath("validate_report.json"))
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 1 || report.Failed != 1 || len(report.Issues) != 1 || report.Issues[0].Kind != issueMissingFile || report.Issues[0].File != "StoryData/Missing.json" {
+		t.Errorf("report %+v, want StoryData/Missing.json missing", report)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// concurrency is how many files are processed at the same time.
+var concurrency = 1
+
+type loggerKey struct{}
+
+// logger returns the logger of the job running in ctx, or the global one.
+func logger(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return zap.S()
+}
+
+// fileJob is the whole chain of steps for one file, its steps always run in
+// order on a single worker.
+type fileJob struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type jobResult struct {
+	log  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// runJobs processes jobs on up to concurrency workers sharing the handler and
+// its rate limiter. Every job logs into its own buffer which is flushed in
+// job order, so the output reads the same as a sequential run. Failed jobs do
+// not stop the others, their errors are summarised and returned joined.
+func runJobs(ctx context.Context, stage string, jobs []fileJob) error {
+	workers := concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	results := make([]*jobResult, len(jobs))
+	for i := range results {
+		results[i] = &jobResult{done: make(chan struct{})}
+	}
+
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				res := results[i]
+				jobctx := context.WithValue(ctx, loggerKey{}, jobLogger(&res.log))
+				res.err = runJob(jobctx, jobs[i])
+				close(res.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		for i := range jobs {
+			select {
+			case <-ctx.Done():
+				for _, res := range results[i:] {
+					res.err = ctx.Err()
+					close(res.done)
+				}
+				return
+			case queue <- i:
+			}
+		}
+	}()
+
+	errs := []error{}
+	failed := 0
+	for i, res := range results {
+		<-res.done
+		os.Stderr.Write(res.log.Bytes())
+		if res.err != nil {
+			failed++
+			errs = append(errs, fmt.Errorf("%s: %w", jobs[i].name, res.err))
+		}
+	}
+	wg.Wait()
+
+	if failed == 0 {
+		zap.S().Infow(stage+" finished", "files", len(jobs))
+		return nil
+	}
+
+	for _, err := range errs {
+		zap.S().Errorw(stage+" file failed", "error", err)
+	}
+	zap.S().Warnw(stage+" finished with errors", "files", len(jobs), "failed", failed, "done", len(jobs)-failed)
+	return errors.Join(errs...)
+}
+
+// runJob turns a panic of the job, like a Fatal on its logger, into its
+// error, so the buffered log is still flushed and the other jobs finish.
+func runJob(ctx context.Context, job fileJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job.run(ctx)
+}
+
+// jobLogger writes the same json lines as the global production logger, but
+// into buf. Fatal panics instead of exiting, see runJob.
+func jobLogger(buf *bytes.Buffer) *zap.SugaredLogger {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := zapcore.NewCore(enc, zapcore.AddSync(buf), zap.InfoLevel)
+	return zap.New(core, zap.AddCaller(), zap.WithFatalHook(zapcore.WriteThenPanic)).Sugar()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// captureStderr returns what fn wrote to os.Stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stderr := os.Stderr
+	os.Stderr = f
+	defer func() { os.Stderr = stderr }()
+	fn()
+
+	b, _ := os.ReadFile(f.Name())
+	return string(b)
+}
+
+func TestRunJobs(t *testing.T) {
+	defer func(n int) { concurrency = n }(concurrency)
+	concurrency = 3
+
+	var running, peak, ran int32
+	jobs := []fileJob{}
+	for i := 0; i < 6; i++ {
+		name := "file" + strconv.Itoa(i)
+		delay := time.Duration(6-i) * 5 * time.Millisecond
+		jobs = append(jobs, fileJob{name: name, run: func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&ran, 1)
+
+			// later jobs finish first, the log must still come out in job order
+			time.Sleep(delay)
+			logger(ctx).Infoln("done", name)
+
+			switch name {
+			case "file1":
+				return errors.New("broken")
+			case "file4":
+				logger(ctx).Fatalln("gave up")
+			}
+			return nil
+		}})
+	}
+
+	var err error
+	out := captureStderr(t, func() { err = runJobs(context.Background(), "test", jobs) })
+
+	if ran != 6 {
+		t.Errorf("%d jobs ran, want every job despite the failures", ran)
+	}
+	if peak > 3 || peak < 2 {
+		t.Errorf("%d jobs ran at once, want up to the concurrency of 3", peak)
+	}
+	if err == nil || !strings.Contains(err.Error(), "file1: broken") || !strings.Contains(err.Error(), "file4: job panicked") {
+		t.Errorf("runJobs error = %v, want both failed files", err)
+	}
+
+	last := -1
+	for i := 0; i < 6; i++ {
+		at := strings.Index(out, `"done file`+strconv.Itoa(i)+`"`)
+		if at < last {
+			t.Fatalf("log of file%d came before an earlier job:\n%s", i, out)
+		}
+		last = at
+	}
+}
+
+func TestRunJobsCancel(t *testing.T) {
+	defer func(n int) { concurrency = n }(concurrency)
+	concurrency = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := []fileJob{
+		{name: "first", run: func(ctx context.Context) error { cancel(); return nil }},
+		{name: "second", run: func(ctx context.Context) error { return ctx.Err() }},
+	}
+
+	err := runJobs(ctx, "test", jobs)
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "first") {
+		t.Errorf("runJobs = %v, want only the second job cancelled", err)
+	}
+}